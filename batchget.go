@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/firestore"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// batchGetChunkSize is the maximum number of documents fetched with a single
+// GetAll request.
+const batchGetChunkSize = 100
+
+var batchGetCmd = &cobra.Command{
+	Use:   "batch-get [document id]...",
+	Short: "get many documents by id in one request",
+	Long: `fetches all given documents in a single request. without arguments the ids
+are read from stdin, one per line. every document is printed with its id as
+"_id", or in the envelope of --raw like get, missing documents are reported on
+stderr. large id lists are fetched in
+chunks of 100, --concurrency chunks at a time, output keeps the input order.
+
+examples:
+firestore-cli batch-get 22da76b6 8b4f8381
+cat ids.txt | firestore-cli batch-get --ignore-missing
+cat ids.txt | firestore-cli batch-get --concurrency 8`,
+	PreRunE: preRunE,
+	RunE:    batchGet,
+}
+
+func batchGet(cmd *cobra.Command, args []string) error {
+	ignoreMissing, err := cmd.Flags().GetBool("ignore-missing")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"ignore-missing\"")
+	}
+	concurrency, err := cmd.Flags().GetInt("concurrency")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"concurrency\"")
+	}
+	if concurrency < 1 {
+		return fmt.Errorf("invalid concurrency %d, must be at least 1", concurrency)
+	}
+	ids := args
+	if len(ids) == 0 {
+		ids, err = readIDs()
+		if err != nil {
+			return err
+		}
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "{\"ProjectID\":\"%s\", \"CollectionPath\":\"%s\", \"Documents\":%d, \"Emulator\":%t}\n",
+			viper.GetString("project"),
+			viper.GetString("collection"),
+			len(ids),
+			emulator)
+	}
+
+	refs := make([]*firestore.DocumentRef, len(ids))
+	for i, id := range ids {
+		refs[i], err = documentRef(id)
+		if err != nil {
+			return err
+		}
+	}
+	ctx, cancelFunc := withTimeout()
+	defer cancelFunc()
+	docs, err := getAll(ctx, refs, concurrency)
+	if err != nil {
+		return err
+	}
+
+	f, err := newFormatter(out)
+	if err != nil {
+		return err
+	}
+	missing := 0
+	for _, doc := range docs {
+		if !doc.Exists() {
+			fmt.Fprintf(os.Stderr, "document %s not found\n", doc.Ref.ID)
+			missing++
+			continue
+		}
+		docData := documentFields(doc)
+		if !viper.GetBool("raw") {
+			// the raw envelope has the id already
+			docData["_id"] = doc.Ref.ID
+		}
+		if err := f.Write(docData); err != nil {
+			return err
+		}
+	}
+	if err := f.Flush(); err != nil {
+		return err
+	}
+	if missing > 0 && !ignoreMissing {
+		return status.Errorf(codes.NotFound, "%d documents not found", missing)
+	}
+	return nil
+}
+
+// getAll fetches the documents in chunks of batchGetChunkSize, running up to
+// concurrency chunks at once. The snapshots are returned in the order of refs.
+// Chunks that fail are retried on their own; the errors of all chunks that
+// still fail are combined.
+func getAll(ctx context.Context, refs []*firestore.DocumentRef, concurrency int) ([]*firestore.DocumentSnapshot, error) {
+	docs := make([]*firestore.DocumentSnapshot, len(refs))
+	sem := make(chan struct{}, concurrency)
+	errs := make([]error, (len(refs)+batchGetChunkSize-1)/batchGetChunkSize)
+	var wg sync.WaitGroup
+	for i := range errs {
+		start := i * batchGetChunkSize
+		end := start + batchGetChunkSize
+		if end > len(refs) {
+			end = len(refs)
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			// the remaining chunks cannot be fetched in time
+			errs[i] = fmt.Errorf("documents %d-%d: %v", start+1, len(refs), ctx.Err())
+		}
+		if errs[i] != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i, start, end int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			err := retry(ctx, func() error {
+				chunk, err := client.GetAll(ctx, refs[start:end])
+				if err == nil {
+					copy(docs[start:end], chunk)
+				}
+				return err
+			})
+			if err != nil {
+				errs[i] = fmt.Errorf("documents %d-%d: %v", start+1, end, err)
+			}
+		}(i, start, end)
+	}
+	wg.Wait()
+	var msgs []string
+	for _, err := range errs {
+		if err != nil {
+			msgs = append(msgs, err.Error())
+		}
+	}
+	if len(msgs) > 0 {
+		return nil, fmt.Errorf("unable to get documents: %s", strings.Join(msgs, "; "))
+	}
+	return docs, nil
+}
+
+// readIDs reads document ids from stdin, one per line, skipping blank lines.
+func readIDs() ([]string, error) {
+	var ids []string
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		if id := strings.TrimSpace(scanner.Text()); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "unable to read document ids from stdin")
+	}
+	if len(ids) == 0 {
+		return nil, errors.New("no document ids given")
+	}
+	return ids, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"cloud.google.com/go/firestore"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/api/iterator"
+)
+
+var collectionsCmd = &cobra.Command{
+	Use:   "collections [document path]",
+	Short: "list root collections or subcollections of a document",
+	Long: `examples:
+firestore-cli collections
+firestore-cli collections users/22da76b6`,
+	Args:    cobra.MaximumNArgs(1),
+	PreRunE: projectPreRunE,
+	RunE:    collections,
+}
+
+func collections(_ *cobra.Command, args []string) error {
+	var documentPath string
+	if len(args) > 0 {
+		documentPath = args[0]
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "{\"ProjectID\":\"%s\", \"DocumentPath\":\"%s\", \"Subcollections\":%t, \"Emulator\":%t}\n",
+			viper.GetString("project"),
+			documentPath,
+			documentPath != "",
+			emulator)
+	}
+
+	ctx, cancelFunc := withTimeout()
+	defer cancelFunc()
+	var iter *firestore.CollectionIterator
+	if documentPath == "" {
+		iter = client.Collections(ctx)
+	} else {
+		docRef := client.Doc(documentPath)
+		if docRef == nil {
+			return fmt.Errorf("invalid document path %q", documentPath)
+		}
+		iter = docRef.Collections(ctx)
+	}
+	for {
+		collRef, err := iter.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "unable to list collections")
+		}
+		fmt.Fprintln(out, collRef.ID)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/api/iterator"
+)
+
+var completionCmd = &cobra.Command{
+	Use:   "completion [bash|zsh|fish|powershell]",
+	Short: "generate shell completion script",
+	Long: `examples:
+source <(firestore-cli completion bash)
+firestore-cli completion zsh > "${fpath[1]}/_firestore-cli"
+firestore-cli completion fish > ~/.config/fish/completions/firestore-cli.fish`,
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	ValidArgs: []string{"bash", "zsh", "fish", "powershell"},
+	RunE:      completion,
+}
+
+func completion(_ *cobra.Command, args []string) error {
+	switch args[0] {
+	case "bash":
+		return rootCmd.GenBashCompletion(os.Stdout)
+	case "zsh":
+		return rootCmd.GenZshCompletion(os.Stdout)
+	case "fish":
+		return rootCmd.GenFishCompletion(os.Stdout, true)
+	default:
+		return rootCmd.GenPowerShellCompletion(os.Stdout)
+	}
+}
+
+// completeCollections offers the root collections of the configured project
+// as completions for the collection flag.
+func completeCollections(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if viper.GetString("project") == "" {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	if err := initFirestoreClient(); err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	ctx, cancelFunc := withTimeout()
+	defer cancelFunc()
+	var ids []string
+	iter := client.Collections(ctx)
+	for {
+		collRef, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		if strings.HasPrefix(collRef.ID, toComplete) {
+			ids = append(ids, collRef.ID)
+		}
+	}
+	return ids, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "print the effective configuration",
+	Long: `prints the settings in effect after applying the config file, the profile and
+the flags as json, along with the config file that was read, if any. nothing
+is sent to firestore.
+
+examples:
+firestore-cli config
+firestore-cli config --profile staging`,
+	Args:    cobra.NoArgs,
+	PreRunE: configPreRunE,
+	RunE:    config,
+}
+
+func config(_ *cobra.Command, _ []string) error {
+	emulatorHost := viper.GetString("emulator-host")
+	if emulatorHost == "" {
+		emulatorHost = os.Getenv("FIRESTORE_EMULATOR_HOST")
+	}
+	// without a limit in the config file the query commands use the default
+	limit := defaultLimit
+	if viper.IsSet("limit") {
+		limit = viper.GetInt("limit")
+	}
+	jsonString, err := jsonString(map[string]interface{}{
+		"configFile":       viper.ConfigFileUsed(),
+		"profile":          viper.GetString("profile"),
+		"project":          viper.GetString("project"),
+		"projectSource":    projectOrigin(),
+		"database":         viper.GetString("database"),
+		"collection":       viper.GetString("collection"),
+		"collectionGroup":  viper.GetString("collection-group"),
+		"credentialSource": credentialSource(viper.GetString("credentials")),
+		"emulatorHost":     emulatorHost,
+		"prettyprint":      viper.GetBool("prettyprint") && !viper.GetBool("compact"),
+		"output":           viper.GetString("output"),
+		"timeout":          viper.GetDuration("timeout").String(),
+		"retries":          viper.GetInt("retries"),
+		"limit":            limit,
+		"unlimited":        viper.GetBool("unlimited"),
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, jsonString)
+	return nil
+}
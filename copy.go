@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var copyCmd = &cobra.Command{
+	Use:   "copy [collection] [document id]",
+	Short: "copy a document to another collection, id or project",
+	Long: `reads a document and writes it with set to the target given by --to-collection,
+--to-id and --to-project, overwriting an existing target document. the
+target defaults to the source collection, id and project, at least one of them
+has to differ. fields can be left out with --strip-fields and renamed with
+--replace-field.
+
+examples:
+firestore-cli copy 22da76b6 --to-collection archive
+firestore-cli copy users 22da76b6 --to-collection archive
+firestore-cli copy users/abc --to-id def --strip-fields password,address.zip
+firestore-cli copy 22da76b6 --to-project my-staging-project
+firestore-cli copy 22da76b6 --to-collection archive --replace-field name=fullName`,
+	Args:    cobra.ExactArgs(1),
+	PreRunE: documentPreRunE,
+	RunE:    copyDocument,
+}
+
+func copyDocument(cmd *cobra.Command, args []string) error {
+	documentID := args[0]
+	toCollection, err := cmd.Flags().GetString("to-collection")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"to-collection\"")
+	}
+	toID, err := cmd.Flags().GetString("to-id")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"to-id\"")
+	}
+	toProject, err := cmd.Flags().GetString("to-project")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"to-project\"")
+	}
+	stripFields, err := cmd.Flags().GetStringSlice("strip-fields")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"strip-fields\"")
+	}
+	renames, err := fieldRenames(cmd)
+	if err != nil {
+		return err
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "{\"ProjectID\":\"%s\", \"CollectionPath\":\"%s\", \"DocumentID\":\"%s\", \"ToProject\":\"%s\", \"ToCollection\":\"%s\", \"ToID\":\"%s\", \"Emulator\":%t}\n",
+			viper.GetString("project"),
+			viper.GetString("collection"),
+			documentID,
+			toProject,
+			toCollection,
+			toID,
+			emulator)
+	}
+
+	source, err := documentRef(documentID)
+	if err != nil {
+		return err
+	}
+	targetClient := client
+	if toProject != "" && toProject != viper.GetString("project") {
+		if targetClient, err = newClient(toProject); err != nil {
+			return err
+		}
+		defer targetClient.Close()
+	}
+	target, err := targetRef(targetClient, documentID, toCollection, toID)
+	if err != nil {
+		return err
+	}
+	if target.Path == source.Path {
+		return errors.New("source and target are the same document, use --to-collection, --to-id or --to-project")
+	}
+
+	ctx, cancelFunc := withTimeout()
+	defer cancelFunc()
+	var docSnap *firestore.DocumentSnapshot
+	err = retry(ctx, func() error {
+		docSnap, err = source.Get(ctx)
+		return err
+	})
+	if status.Code(err) == codes.NotFound {
+		return errors.Wrapf(err, "document %s not found", documentID)
+	}
+	if err != nil {
+		return errors.Wrap(err, "unable to get document")
+	}
+	data := docSnap.Data()
+	for _, field := range stripFields {
+		deleteField(data, strings.Split(field, "."))
+	}
+	renameFields(data, renames)
+
+	if viper.GetBool("dry-run") {
+		return printDryRun("set", target, data)
+	}
+	if _, err := target.Set(ctx, data); err != nil {
+		return errors.Wrap(err, "unable to set target document")
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "copied %s to %s\n", source.Path, target.Path)
+	}
+	return nil
+}
+
+// targetRef returns the document the source document is copied to with the
+// client. The collection and id default to the ones of the source.
+func targetRef(c *firestore.Client, documentID, toCollection, toID string) (*firestore.DocumentRef, error) {
+	if toCollection == "" {
+		toCollection = viper.GetString("collection")
+		if i := strings.LastIndex(documentID, "/"); i >= 0 {
+			toCollection = documentID[:i]
+		}
+	} else if err := validatePath(toCollection, true); err != nil {
+		return nil, err
+	}
+	if toID == "" {
+		toID = documentID[strings.LastIndex(documentID, "/")+1:]
+	}
+	return c.Collection(toCollection).Doc(toID), nil
+}
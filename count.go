@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var countCmd = &cobra.Command{
+	Use:   "count [collection] [name] [operator] [value]",
+	Short: "count documents in a collection",
+	Long: `counts the documents matching the optional where clauses using an aggregation
+query, without downloading the documents.
+for very large collections --estimate bounds the time spent counting. if the
+count does not finish in time, the documents are counted again up to
+--estimate-limit and "at least n" is printed if there are more.
+a count is billed one document read per 1000 index entries it matches, a count
+that ran out of time is still billed for the entries it scanned. the bounded
+count adds at most --estimate-limit/1000 reads, no documents are downloaded.
+
+examples:
+firestore-cli count
+firestore-cli count status == active --where "age > 18"
+firestore-cli count --estimate 2s`,
+	Args:    whereArgs,
+	PreRunE: queryPreRunE,
+	RunE:    count,
+}
+
+func count(cmd *cobra.Command, args []string) error {
+	clauses, err := whereClauses(cmd, args)
+	if err != nil {
+		return err
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "{\"ProjectID\":\"%s\", \"CollectionPath\":\"%s\", \"Emulator\":%t, \"Query\":\"%v\"}\n",
+			viper.GetString("project"),
+			viper.GetString("collection"),
+			emulator,
+			clausesString(clauses))
+	}
+
+	q := applyClauses(collectionQuery(), clauses)
+	budget, err := cmd.Flags().GetDuration("estimate")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"estimate\"")
+	}
+	if budget > 0 {
+		limit, err := cmd.Flags().GetInt("estimate-limit")
+		if err != nil {
+			return errors.Wrap(err, "unable to get flag \"estimate-limit\"")
+		}
+		if limit < 1 {
+			return fmt.Errorf("invalid estimate limit %d, must be at least 1", limit)
+		}
+		return estimateCount(q, budget, limit)
+	}
+	ctx, cancelFunc := withTimeout()
+	defer cancelFunc()
+	res, err := q.NewAggregationQuery().WithCount("count").Get(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to count documents")
+	}
+	fmt.Fprintln(out, res.Data()["count"])
+	return nil
+}
+
+var aggregateCmd = &cobra.Command{
+	Use:   "aggregate [collection] [name] [operator] [value]",
+	Short: "compute count, sum and average aggregations",
+	Long: `computes the requested aggregations over the documents matching the optional
+where clauses in a single request. results are keyed "count", "sum_<field>"
+and "avg_<field>".
+
+examples:
+firestore-cli aggregate --sum price
+firestore-cli aggregate status == active --count --sum price --avg rating`,
+	Args:    whereArgs,
+	PreRunE: queryPreRunE,
+	RunE:    aggregate,
+}
+
+func aggregate(cmd *cobra.Command, args []string) error {
+	clauses, err := whereClauses(cmd, args)
+	if err != nil {
+		return err
+	}
+	withCount, err := cmd.Flags().GetBool("count")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"count\"")
+	}
+	sums, err := cmd.Flags().GetStringArray("sum")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"sum\"")
+	}
+	avgs, err := cmd.Flags().GetStringArray("avg")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"avg\"")
+	}
+	if !withCount && len(sums) == 0 && len(avgs) == 0 {
+		return errors.New("no aggregation given, use --count, --sum or --avg")
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "{\"ProjectID\":\"%s\", \"CollectionPath\":\"%s\", \"Emulator\":%t, \"Query\":\"%v\"}\n",
+			viper.GetString("project"),
+			viper.GetString("collection"),
+			emulator,
+			clausesString(clauses))
+	}
+
+	q := applyClauses(collectionQuery(), clauses)
+	aq := q.NewAggregationQuery()
+	if withCount {
+		aq = aq.WithCount("count")
+	}
+	for _, field := range sums {
+		aq = aq.WithSum(field, "sum_"+field)
+	}
+	for _, field := range avgs {
+		aq = aq.WithAvg(field, "avg_"+field)
+	}
+	ctx, cancelFunc := withTimeout()
+	defer cancelFunc()
+	res, err := aq.Get(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to aggregate documents")
+	}
+
+	f, err := newFormatter(out)
+	if err != nil {
+		return err
+	}
+	if err := f.Write(res.Data()); err != nil {
+		return err
+	}
+	return f.Flush()
+}
+
+// estimateCount counts the documents of the query within the time budget. If
+// the count aggregation does not finish in time, the documents are counted
+// again up to the limit, giving "at least limit" if there are more.
+func estimateCount(q firestore.Query, budget time.Duration, limit int) error {
+	ctx, cancelFunc := context.WithTimeout(rootCtx, budget)
+	defer cancelFunc()
+	res, err := q.NewAggregationQuery().WithCount("count").Get(ctx)
+	if err == nil {
+		fmt.Fprintln(out, res.Data()["count"])
+		return nil
+	}
+	if ctx.Err() == nil || rootCtx.Err() != nil {
+		// only running out of the budget falls back to the bounded count
+		return errors.Wrap(err, "unable to count documents")
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "{\"Estimate\":\"count did not finish in %v, counting at most %d documents\"}\n", budget, limit)
+	}
+	boundedCtx, cancelBounded := withTimeout()
+	defer cancelBounded()
+	bounded := q.Limit(limit)
+	res, err = bounded.NewAggregationQuery().WithCount("count").Get(boundedCtx)
+	if err != nil {
+		return errors.Wrap(err, "unable to count documents")
+	}
+	n := res.Data()["count"].(int64)
+	if n < int64(limit) {
+		fmt.Fprintln(out, n)
+		return nil
+	}
+	fmt.Fprintf(out, "at least %d\n", n)
+	return nil
+}
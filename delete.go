@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"cloud.google.com/go/firestore"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var deleteCmd = &cobra.Command{
+	Use:   "delete [collection] [document id]",
+	Short: "delete a document by id",
+	Long: `deletes the document. it can also be given as a full document path, in which
+case the collection is not needed.
+
+examples:
+firestore-cli delete 22da76b6
+firestore-cli delete users 22da76b6
+firestore-cli delete users/abc/orders/22da76b6`,
+	Args:    cobra.ExactArgs(1),
+	PreRunE: documentPreRunE,
+	RunE:    deleteDocument,
+}
+
+func deleteDocument(cmd *cobra.Command, args []string) error {
+	documentID := args[0]
+	mustExist, err := cmd.Flags().GetBool("exists-precondition")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"exists-precondition\"")
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "{\"ProjectID\":\"%s\", \"CollectionPath\":\"%s\", \"DocumentID\":\"%s\", \"Emulator\":%t}\n",
+			viper.GetString("project"),
+			viper.GetString("collection"),
+			documentID,
+			emulator)
+	}
+
+	docRef, err := documentRef(documentID)
+	if err != nil {
+		return err
+	}
+	if viper.GetBool("dry-run") {
+		return printDryRun("delete", docRef, nil)
+	}
+
+	var preconds []firestore.Precondition
+	if mustExist {
+		preconds = append(preconds, firestore.Exists)
+	}
+	ctx, cancelFunc := withTimeout()
+	defer cancelFunc()
+	_, err = docRef.Delete(ctx, preconds...)
+	if status.Code(err) == codes.NotFound {
+		return errors.Wrapf(err, "document %s does not exist", documentID)
+	}
+	if err != nil {
+		return errors.Wrap(err, "unable to delete document")
+	}
+
+	if verbose {
+		fmt.Fprintf(os.Stderr, "deleted document %s\n", documentID)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var deleteQueryCmd = &cobra.Command{
+	Use:   "delete-query [collection] [name] [operator] [value]",
+	Short: "delete all documents matching a query",
+	Long: `deletes every document matching the optional where clauses, in batches of
+--batch-size documents. without where clauses all documents of the collection
+are deleted. as a safeguard --confirm is required, unless the deletion is
+confirmed at the prompt shown on a terminal. with --dry-run the documents
+that would be deleted are printed instead. subcollections are not deleted.
+
+examples:
+firestore-cli delete-query status == expired --confirm
+firestore-cli delete-query users status == expired --where "updatedAt < 2023-01-01T00:00:00Z" --dry-run
+firestore-cli delete-query --collection-group sessions --confirm`,
+	Args:    whereArgs,
+	PreRunE: queryPreRunE,
+	RunE:    deleteQuery,
+}
+
+func deleteQuery(cmd *cobra.Command, args []string) error {
+	clauses, err := whereClauses(cmd, args)
+	if err != nil {
+		return err
+	}
+	confirmed, err := cmd.Flags().GetBool("confirm")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"confirm\"")
+	}
+	batchSize, err := cmd.Flags().GetInt("batch-size")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"batch-size\"")
+	}
+	if batchSize <= 0 {
+		return fmt.Errorf("invalid batch size %d, must be positive", batchSize)
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "{\"ProjectID\":\"%s\", \"CollectionPath\":\"%s\", \"Emulator\":%t, \"Query\":\"%v\"}\n",
+			viper.GetString("project"),
+			viper.GetString("collection"),
+			emulator,
+			clausesString(clauses))
+	}
+
+	// only the references of the documents are needed
+	q := applyClauses(collectionQuery(), clauses).Select()
+	if viper.GetBool("dry-run") {
+		return previewDeletes(q)
+	}
+	if !confirmed {
+		question := fmt.Sprintf("delete all documents in %s?", queryTarget())
+		if len(clauses) > 0 {
+			question = fmt.Sprintf("delete all documents matching %q in %s?", clausesString(clauses), queryTarget())
+		}
+		ok, err := confirm(question)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("deletion not confirmed, use --confirm to skip the prompt")
+		}
+	}
+
+	deleted := 0
+	for {
+		n, err := deleteBatch(q.Limit(batchSize))
+		deleted += n
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "{\"Deleted\":%d}\n", deleted)
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		if verbose {
+			fmt.Fprintf(os.Stderr, "deleted %d documents\n", deleted)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "{\"Deleted\":%d}\n", deleted)
+	return nil
+}
+
+// deleteBatch deletes the documents of the query and returns their number.
+// Deleted documents no longer match, so the query returns the next batch when
+// run again. It fails if any document could not be deleted, which would be
+// returned again.
+func deleteBatch(q firestore.Query) (int, error) {
+	ctx, cancelFunc := withTimeout()
+	defer cancelFunc()
+	var docs []*firestore.DocumentSnapshot
+	err := retry(ctx, func() error {
+		var err error
+		docs, err = q.Documents(ctx).GetAll()
+		return err
+	})
+	if err != nil {
+		return 0, iterateError(err)
+	}
+	bw := client.BulkWriter(ctx)
+	jobs := make([]*firestore.BulkWriterJob, 0, len(docs))
+	for _, doc := range docs {
+		job, err := bw.Delete(doc.Ref)
+		if err != nil {
+			bw.End()
+			return 0, errors.Wrapf(err, "unable to delete document %s", doc.Ref.ID)
+		}
+		jobs = append(jobs, job)
+	}
+	bw.End()
+	deleted, failed := 0, 0
+	for i, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", docs[i].Ref.Path, err)
+			failed++
+			continue
+		}
+		deleted++
+	}
+	if failed > 0 {
+		return deleted, fmt.Errorf("unable to delete %d documents", failed)
+	}
+	return deleted, nil
+}
+
+// previewDeletes prints a dry run delete for every document of the query.
+func previewDeletes(q firestore.Query) error {
+	ctx, cancelFunc := withTimeout()
+	defer cancelFunc()
+	var docs []*firestore.DocumentSnapshot
+	err := retry(ctx, func() error {
+		var err error
+		docs, err = q.Documents(ctx).GetAll()
+		return err
+	})
+	if err != nil {
+		return iterateError(err)
+	}
+	for _, doc := range docs {
+		if err := printDryRun("delete", doc.Ref, nil); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "{\"DryRun\":%d}\n", len(docs))
+	return nil
+}
+
+// queryTarget names the collection or collection group a query runs on.
+func queryTarget() string {
+	if group := viper.GetString("collection-group"); group != "" {
+		return "collection group " + group
+	}
+	return "collection " + viper.GetString("collection")
+}
+
+// confirm asks a yes/no question on stderr and reads the answer from stdin.
+// Without a terminal on stdin nobody can answer, so it returns false.
+func confirm(question string) (bool, error) {
+	fi, err := os.Stdin.Stat()
+	if err != nil {
+		return false, errors.Wrap(err, "unable to stat stdin")
+	}
+	if fi.Mode()&os.ModeCharDevice == 0 {
+		return false, nil
+	}
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false, nil
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
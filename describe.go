@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"cloud.google.com/go/firestore"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var describeCmd = &cobra.Command{
+	Use:   "describe [collection] [document id]",
+	Short: "print document metadata",
+	Long: `prints the path, id, create, update and read time of a document.
+
+examples:
+firestore-cli describe 22da76b6
+firestore-cli describe users/abc/orders/22da76b6`,
+	Args:    cobra.ExactArgs(1),
+	PreRunE: documentPreRunE,
+	RunE:    describe,
+}
+
+func describe(_ *cobra.Command, args []string) error {
+	documentID := args[0]
+	if verbose {
+		fmt.Fprintf(os.Stderr, "{\"ProjectID\":\"%s\", \"CollectionPath\":\"%s\", \"DocumentID\":\"%s\", \"Emulator\":%t}\n",
+			viper.GetString("project"),
+			viper.GetString("collection"),
+			documentID,
+			emulator)
+	}
+	docRef, err := documentRef(documentID)
+	if err != nil {
+		return err
+	}
+	ctx, cancelFunc := withTimeout()
+	defer cancelFunc()
+	var docSnap *firestore.DocumentSnapshot
+	err = retry(ctx, func() error {
+		docSnap, err = docRef.Get(ctx)
+		return err
+	})
+	if status.Code(err) == codes.NotFound {
+		return errors.Wrapf(err, "document %s not found", documentID)
+	}
+	if err != nil {
+		return errors.Wrap(err, "unable to get document")
+	}
+
+	f, err := newFormatter(out)
+	if err != nil {
+		return err
+	}
+	err = f.Write(map[string]interface{}{
+		"path":       docSnap.Ref.Path,
+		"id":         docSnap.Ref.ID,
+		"createTime": docSnap.CreateTime,
+		"updateTime": docSnap.UpdateTime,
+		"readTime":   docSnap.ReadTime,
+	})
+	if err != nil {
+		return err
+	}
+	return f.Flush()
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"cloud.google.com/go/firestore"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// diffPageSize is the number of documents of each collection read at a time.
+const diffPageSize = 1000
+
+var diffCmd = &cobra.Command{
+	Use:   "diff [collection]",
+	Short: "compare the documents of two collections by id",
+	Long: `compares the documents of the collection with the documents of the same id in
+the collection given with --against, for example to verify a migration. both
+collections are read in document id order side by side, so they are not loaded
+into memory. every difference is printed as a json line:
+
+{"_id":"a","diff":"removed"}    only in the collection
+{"_id":"b","diff":"added"}      only in the --against collection
+{"_id":"c","diff":"changed","fields":{"age":{"from":1,"to":2},"tmp":{"from":true}}}
+
+fields are compared with dotted paths for nested fields, a field missing on
+one side has no "from" or "to". the number of added, removed, changed and
+unchanged documents is printed to stderr. the collections are read in pages of
+1000 documents, --timeout applies to each page rather than the whole diff.
+
+examples:
+firestore-cli diff users --against users_v2
+firestore-cli diff --collection users --against users_v2 --timeout 0`,
+	Args:    cobra.NoArgs,
+	PreRunE: preRunE,
+	RunE:    diff,
+}
+
+// fieldDiff is a changed field with its json encoded values, from or to are
+// nil if the field only exists on one side. Null values are encoded as null.
+type fieldDiff struct {
+	from, to json.RawMessage
+}
+
+func (d fieldDiff) MarshalJSON() ([]byte, error) {
+	fields := map[string]json.RawMessage{}
+	if d.from != nil {
+		fields["from"] = d.from
+	}
+	if d.to != nil {
+		fields["to"] = d.to
+	}
+	return json.Marshal(fields)
+}
+
+// documentDiff is a line of the diff output.
+type documentDiff struct {
+	ID     string               `json:"_id"`
+	Diff   string               `json:"diff"`
+	Fields map[string]fieldDiff `json:"fields,omitempty"`
+}
+
+func diff(cmd *cobra.Command, _ []string) error {
+	against, err := cmd.Flags().GetString("against")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"against\"")
+	}
+	if against == "" {
+		return errors.New("against undefined, give the collection to compare with")
+	}
+	if err := validatePath(against, true); err != nil {
+		return err
+	}
+	if against == viper.GetString("collection") {
+		return errors.New("collection and --against are the same collection")
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "{\"ProjectID\":\"%s\", \"CollectionPath\":\"%s\", \"Against\":\"%s\", \"Emulator\":%t}\n",
+			viper.GetString("project"),
+			viper.GetString("collection"),
+			against,
+			emulator)
+	}
+
+	left := &pageIterator{q: collection().OrderBy(firestore.DocumentID, firestore.Asc), size: diffPageSize, timeout: viper.GetDuration("timeout")}
+	right := &pageIterator{q: client.Collection(against).OrderBy(firestore.DocumentID, firestore.Asc), size: diffPageSize, timeout: viper.GetDuration("timeout")}
+
+	enc := json.NewEncoder(out)
+	counts := map[string]int{}
+	write := func(d documentDiff) error {
+		counts[d.Diff]++
+		if err := enc.Encode(d); err != nil {
+			return errors.Wrap(err, "unable to marshal diff to json")
+		}
+		return nil
+	}
+	l, err := left.Next()
+	if err != nil {
+		return err
+	}
+	r, err := right.Next()
+	if err != nil {
+		return err
+	}
+	for l != nil || r != nil {
+		switch {
+		case r == nil || (l != nil && l.Ref.ID < r.Ref.ID):
+			if err := write(documentDiff{ID: l.Ref.ID, Diff: "removed"}); err != nil {
+				return err
+			}
+			if l, err = left.Next(); err != nil {
+				return err
+			}
+		case l == nil || r.Ref.ID < l.Ref.ID:
+			if err := write(documentDiff{ID: r.Ref.ID, Diff: "added"}); err != nil {
+				return err
+			}
+			if r, err = right.Next(); err != nil {
+				return err
+			}
+		default:
+			fields, err := fieldDiffs(l.Data(), r.Data())
+			if err != nil {
+				return err
+			}
+			if len(fields) == 0 {
+				counts["unchanged"]++
+			} else if err := write(documentDiff{ID: l.Ref.ID, Diff: "changed", Fields: fields}); err != nil {
+				return err
+			}
+			if l, err = left.Next(); err != nil {
+				return err
+			}
+			if r, err = right.Next(); err != nil {
+				return err
+			}
+		}
+	}
+	fmt.Fprintf(os.Stderr, "{\"Added\":%d, \"Removed\":%d, \"Changed\":%d, \"Unchanged\":%d}\n",
+		counts["added"], counts["removed"], counts["changed"], counts["unchanged"])
+	return nil
+}
+
+// fieldDiffs compares the fields of two documents by their dotted paths and
+// their json encoding.
+func fieldDiffs(from, to map[string]interface{}) (map[string]fieldDiff, error) {
+	flatFrom, err := flatJSON(from)
+	if err != nil {
+		return nil, err
+	}
+	flatTo, err := flatJSON(to)
+	if err != nil {
+		return nil, err
+	}
+	diffs := map[string]fieldDiff{}
+	for k, v := range flatFrom {
+		if w, ok := flatTo[k]; !ok || string(v) != string(w) {
+			diffs[k] = fieldDiff{from: v, to: w}
+		}
+	}
+	for k, w := range flatTo {
+		if _, ok := flatFrom[k]; !ok {
+			diffs[k] = fieldDiff{to: w}
+		}
+	}
+	return diffs, nil
+}
+
+// flatJSON flattens the document data to dotted paths and json encodes the
+// values.
+func flatJSON(docData map[string]interface{}) (map[string]json.RawMessage, error) {
+	flat := map[string]interface{}{}
+	for k, v := range outputData(docData) {
+		flatten(flat, k, v)
+	}
+	encoded := make(map[string]json.RawMessage, len(flat))
+	for k, value := range flat {
+		v, err := json.Marshal(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to marshal field %s to json", k)
+		}
+		encoded[k] = v
+	}
+	return encoded, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var existsCmd = &cobra.Command{
+	Use:   "exists [collection] [document id]",
+	Short: "check whether a document exists",
+	Long: `prints nothing and exits with code 0 if the document exists and 2 if it does
+not. other failures exit with their usual exit codes, so scripts can tell a
+missing document from an error.
+
+examples:
+firestore-cli exists 22da76b6 && echo found
+firestore-cli exists users/abc/orders/22da76b6`,
+	Args:         cobra.ExactArgs(1),
+	PreRunE:      documentPreRunE,
+	RunE:         exists,
+	SilenceUsage: true,
+}
+
+func exists(_ *cobra.Command, args []string) error {
+	documentID := args[0]
+	if verbose {
+		fmt.Fprintf(os.Stderr, "{\"ProjectID\":\"%s\", \"CollectionPath\":\"%s\", \"DocumentID\":\"%s\", \"Emulator\":%t}\n",
+			viper.GetString("project"),
+			viper.GetString("collection"),
+			documentID,
+			emulator)
+	}
+	docRef, err := documentRef(documentID)
+	if err != nil {
+		return err
+	}
+	ctx, cancelFunc := withTimeout()
+	defer cancelFunc()
+	err = retry(ctx, func() error {
+		_, err := docRef.Get(ctx)
+		return err
+	})
+	if status.Code(err) == codes.NotFound {
+		return silentError{errors.Wrapf(err, "document %s not found", documentID)}
+	}
+	return errors.Wrap(err, "unable to get document")
+}
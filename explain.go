@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// explain prints a description of the query and the structured query sent to
+// firestore, without running it.
+func explain(cmd *cobra.Command, q firestore.Query, clauses []clause) error {
+	if group := viper.GetString("collection-group"); group != "" {
+		fmt.Fprintf(out, "collection group: %s\n", group)
+	} else {
+		fmt.Fprintf(out, "collection: %s\n", viper.GetString("collection"))
+	}
+	for _, c := range clauses {
+		fmt.Fprintf(out, "where: %v\n", c)
+	}
+	orders, err := orderBys(cmd)
+	if err != nil {
+		return err
+	}
+	for _, o := range orders {
+		dir := "asc"
+		if o.dir == firestore.Desc {
+			dir = "desc"
+		}
+		fmt.Fprintf(out, "order by: %s %s\n", o.path, dir)
+	}
+	for _, flag := range []string{"start-after", "after-id", "start-at", "end-at"} {
+		if value, _ := cmd.Flags().GetString(flag); value != "" {
+			fmt.Fprintf(out, "%s: %s\n", flag, value)
+		}
+	}
+	if cmd.Flags().Lookup("id-prefix") != nil {
+		if prefix, _ := cmd.Flags().GetString("id-prefix"); prefix != "" {
+			fmt.Fprintf(out, "id prefix: %s\n", prefix)
+		}
+	}
+	if fields, _ := cmd.Flags().GetStringSlice("select"); len(fields) > 0 {
+		fmt.Fprintf(out, "select: %s\n", strings.Join(fields, ", "))
+	}
+	if limitToLast, _ := cmd.Flags().GetInt("limit-to-last"); limitToLast > 0 {
+		fmt.Fprintf(out, "limit to last: %d\n", limitToLast)
+	} else if viper.GetBool("unlimited") {
+		fmt.Fprintln(out, "limit: none")
+	} else {
+		// the limit is not part of the query, reading stops after it
+		fmt.Fprintf(out, "limit: %d (applied while reading)\n", viper.GetInt("limit"))
+	}
+
+	wire, err := q.Serialize()
+	if err != nil {
+		return errors.Wrap(err, "unable to serialize query")
+	}
+	var req firestorepb.RunQueryRequest
+	if err := proto.Unmarshal(wire, &req); err != nil {
+		return errors.Wrap(err, "unable to unmarshal query")
+	}
+	protoJSON, err := protojson.Marshal(&req)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal query to json")
+	}
+	// protojson varies its whitespace between runs on purpose, re-indent it
+	// so the output can be diffed
+	var jsonData bytes.Buffer
+	if err := json.Indent(&jsonData, protoJSON, "", "  "); err != nil {
+		return errors.Wrap(err, "unable to indent query json")
+	}
+	fmt.Fprintf(out, "structured query:\n%s\n", jsonData.String())
+	return nil
+}
+
+// analyzeQuery has firestore run the query with explain analyze, returning
+// execution metrics with the results. The metrics come at the end of the
+// results, so unless field filters drop documents the query is limited to the
+// documents read, including the one telling whether results were cut short.
+// It reports whether it limited the query.
+func analyzeQuery(cmd *cobra.Command, q firestore.Query, r *results) (firestore.Query, bool) {
+	limitToLast, _ := cmd.Flags().GetInt("limit-to-last")
+	limited := !viper.GetBool("unlimited") && limitToLast == 0 && len(r.filters) == 0
+	if limited {
+		q = q.Limit(viper.GetInt("limit") + 1)
+	}
+	return q.WithRunOptions(firestore.ExplainOptions{Analyze: true}), limited
+}
+
+// addMetrics reads the explain metrics from the iterator. If the query was
+// limited by analyzeQuery the rest of the results are read first, otherwise
+// reading stopped early and there are no metrics.
+func (r *results) addMetrics(iter *firestore.DocumentIterator, limited bool) {
+	if limited {
+		for {
+			if _, err := iter.Next(); err != nil {
+				break
+			}
+		}
+	}
+	metrics, err := iter.ExplainMetrics()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "query metrics unavailable: %v\n", err)
+		return
+	}
+	r.metrics = append(r.metrics, metrics)
+}
+
+// printMetrics prints the explain metrics of the queries as json lines to
+// stderr.
+func (r *results) printMetrics() {
+	for _, m := range r.metrics {
+		metrics := map[string]interface{}{}
+		if m.PlanSummary != nil {
+			metrics["IndexesUsed"] = m.PlanSummary.IndexesUsed
+		}
+		if s := m.ExecutionStats; s != nil {
+			metrics["ResultsReturned"] = s.ResultsReturned
+			metrics["ReadOperations"] = s.ReadOperations
+			if s.ExecutionDuration != nil {
+				metrics["ExecutionDuration"] = s.ExecutionDuration.String()
+			}
+			if s.DebugStats != nil {
+				metrics["DebugStats"] = s.DebugStats
+			}
+		}
+		jsonData, err := json.Marshal(metrics)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to marshal query metrics: %v\n", err)
+			continue
+		}
+		fmt.Fprintln(os.Stderr, string(jsonData))
+	}
+}
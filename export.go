@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/api/iterator"
+)
+
+// exportProgressInterval is the number of documents between progress reports
+// in verbose mode.
+const exportProgressInterval = 1000
+
+var exportCmd = &cobra.Command{
+	Use:   "export [collection] [name] [operator] [value]",
+	Short: "export all documents of a collection as newline delimited json",
+	Long: `writes every document of the collection, or every document matching the
+optional where clauses, as one json line including its id as "_id". the
+output can be read back with the import command using --id-field _id, but
+json has no firestore types: timestamps are imported as strings, references
+as path strings, geo points as {"lat","lng"} maps and bytes as base64
+strings. strings, numbers, booleans, null, maps and arrays keep their types.
+--timeout applies to the whole export. with --page-timeout the documents are
+read in pages of --page-size documents instead, each with its own timeout, so
+large exports are not cut short while a stalled request still fails.
+
+examples:
+firestore-cli export --file backup.jsonl
+firestore-cli export status == active --order-by createdAt > active.jsonl
+firestore-cli export --replace-field name=fullName --replace-field zip=address.zip
+firestore-cli export --page-timeout 30s --page-size 5000 --file backup.jsonl`,
+	Args:    whereArgs,
+	PreRunE: queryPreRunE,
+	RunE:    export,
+}
+
+func export(cmd *cobra.Command, args []string) error {
+	file, err := cmd.Flags().GetString("file")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"file\"")
+	}
+	renames, err := fieldRenames(cmd)
+	if err != nil {
+		return err
+	}
+	clauses, err := whereClauses(cmd, args)
+	if err != nil {
+		return err
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "{\"ProjectID\":\"%s\", \"CollectionPath\":\"%s\", \"File\":\"%s\", \"Emulator\":%t, \"Query\":\"%v\"}\n",
+			viper.GetString("project"),
+			viper.GetString("collection"),
+			file,
+			emulator,
+			clausesString(clauses))
+	}
+	q, err := buildQuery(cmd, clauses)
+	if err != nil {
+		return err
+	}
+
+	w := out
+	if file != "" && file != "-" {
+		f, err := os.Create(file)
+		if err != nil {
+			return errors.Wrap(err, "unable to create export file")
+		}
+		defer f.Close()
+		w = f
+	}
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	n := 0
+	write := func(doc *firestore.DocumentSnapshot) error {
+		docData := outputData(doc.Data())
+		renameFields(docData, renames)
+		docData["_id"] = doc.Ref.ID
+		if err := enc.Encode(docData); err != nil {
+			return errors.Wrap(err, "unable to marshal document to json")
+		}
+		n++
+		if verbose && n%exportProgressInterval == 0 {
+			fmt.Fprintf(os.Stderr, "exported %d documents\n", n)
+		}
+		return nil
+	}
+
+	pageTimeout, err := cmd.Flags().GetDuration("page-timeout")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"page-timeout\"")
+	}
+	if pageTimeout > 0 {
+		err = exportPages(cmd, q, pageTimeout, write)
+	} else {
+		err = exportAll(q, write)
+	}
+	if err != nil {
+		_ = bw.Flush()
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return errors.Wrap(err, "unable to write export")
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "exported %d documents\n", n)
+	}
+	return nil
+}
+
+// exportAll streams the documents of the query to write, all within the
+// configured timeout.
+func exportAll(q firestore.Query, write func(*firestore.DocumentSnapshot) error) error {
+	ctx, cancelFunc := withTimeout()
+	defer cancelFunc()
+	iter := q.Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return iterateError(err)
+		}
+		if err := write(doc); err != nil {
+			return err
+		}
+	}
+}
+
+// pageIterator reads the documents of a query in pages of size documents,
+// each fetched with its own timeout, so reading all of them can take as long
+// as it needs while a stalled request still fails. Pages failing with
+// transient errors, including their timeout, are retried.
+type pageIterator struct {
+	q       firestore.Query
+	size    int
+	timeout time.Duration
+	docs    []*firestore.DocumentSnapshot
+	last    *firestore.DocumentSnapshot
+	done    bool
+}
+
+// Next returns the next document, or nil after the last one.
+func (it *pageIterator) Next() (*firestore.DocumentSnapshot, error) {
+	if len(it.docs) == 0 {
+		if it.done {
+			return nil, nil
+		}
+		page := it.q.Limit(it.size)
+		if it.last != nil {
+			page = page.StartAfter(it.last)
+		}
+		err := retry(rootCtx, func() error {
+			// a retry gets a fresh timeout
+			var ctx context.Context
+			var cancelFunc context.CancelFunc
+			if it.timeout > 0 {
+				ctx, cancelFunc = context.WithTimeout(rootCtx, it.timeout)
+			} else {
+				ctx, cancelFunc = context.WithCancel(rootCtx)
+			}
+			defer cancelFunc()
+			var err error
+			it.docs, err = page.Documents(ctx).GetAll()
+			return err
+		})
+		if err != nil {
+			return nil, iterateError(err)
+		}
+		it.done = len(it.docs) < it.size
+		if len(it.docs) == 0 {
+			return nil, nil
+		}
+		it.last = it.docs[len(it.docs)-1]
+	}
+	doc := it.docs[0]
+	it.docs = it.docs[1:]
+	return doc, nil
+}
+
+// exportPages reads the documents of the query in pages of --page-size
+// documents, each with its own timeout instead of the overall one, and passes
+// them to write.
+func exportPages(cmd *cobra.Command, q firestore.Query, pageTimeout time.Duration, write func(*firestore.DocumentSnapshot) error) error {
+	pageSize, err := cmd.Flags().GetInt("page-size")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"page-size\"")
+	}
+	if pageSize <= 0 {
+		return fmt.Errorf("invalid page size %d, must be positive", pageSize)
+	}
+	it := &pageIterator{q: q, size: pageSize, timeout: pageTimeout}
+	for {
+		doc, err := it.Next()
+		if err != nil || doc == nil {
+			return err
+		}
+		if err := write(doc); err != nil {
+			return err
+		}
+	}
+}
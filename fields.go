@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// fieldRename moves the value of a field to another field.
+type fieldRename struct {
+	from, to []string
+}
+
+// fieldRenames parses the repeatable "replace-field" flag of the form
+// old=new, where both sides can be dotted paths.
+func fieldRenames(cmd *cobra.Command) ([]fieldRename, error) {
+	values, err := cmd.Flags().GetStringArray("replace-field")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get flag \"replace-field\"")
+	}
+	renames := make([]fieldRename, 0, len(values))
+	for _, v := range values {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid replace-field %q, expected old=new", v)
+		}
+		renames = append(renames, fieldRename{from: strings.Split(parts[0], "."), to: strings.Split(parts[1], ".")})
+	}
+	return renames, nil
+}
+
+// renameFields applies the renames to the document data in order. Fields
+// missing in the document are skipped.
+func renameFields(data map[string]interface{}, renames []fieldRename) {
+	for _, r := range renames {
+		value, ok := fieldValue(data, r.from)
+		if !ok {
+			continue
+		}
+		deleteField(data, r.from)
+		setField(data, r.to, value)
+	}
+}
+
+// fieldValue returns the value of the field at the path.
+func fieldValue(data map[string]interface{}, path []string) (interface{}, bool) {
+	for _, field := range path[:len(path)-1] {
+		next, ok := data[field].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		data = next
+	}
+	value, ok := data[path[len(path)-1]]
+	return value, ok
+}
+
+// setField sets the field at the path, creating missing parent maps.
+func setField(data map[string]interface{}, path []string, value interface{}) {
+	for _, field := range path[:len(path)-1] {
+		next, ok := data[field].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			data[field] = next
+		}
+		data = next
+	}
+	data[path[len(path)-1]] = value
+}
+
+// deleteField removes the field at the path from the document data.
+func deleteField(data map[string]interface{}, path []string) {
+	for _, field := range path[:len(path)-1] {
+		next, ok := data[field].(map[string]interface{})
+		if !ok {
+			return
+		}
+		data = next
+	}
+	delete(data, path[len(path)-1])
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// documentFilter is a predicate on documents evaluated by the cli after the
+// documents were fetched.
+type documentFilter interface {
+	match(doc *firestore.DocumentSnapshot) bool
+}
+
+// filterOperators are the operators of client-side field filters: regular
+// expression match, its negation, and substring containment.
+var filterOperators = []string{"!~=", "~=", "*="}
+
+// fieldFilter is a predicate on a document field evaluated by the cli after
+// the documents were fetched.
+type fieldFilter struct {
+	path  []string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+// parseFieldFilter parses a filter of the form "field~=regexp",
+// "field!~=regexp" or "field*=substring". Nested fields use dotted paths.
+func parseFieldFilter(s string) (fieldFilter, error) {
+	i, op := -1, ""
+	for _, o := range filterOperators {
+		if j := strings.Index(s, o); j > 0 && (i < 0 || j < i) {
+			i, op = j, o
+		}
+	}
+	if i < 0 {
+		return fieldFilter{}, fmt.Errorf("invalid field filter %q, expected field~=regexp, field!~=regexp or field*=substring", s)
+	}
+	f := fieldFilter{path: strings.Split(s[:i], "."), op: op, value: s[i+len(op):]}
+	if op != "*=" {
+		re, err := regexp.Compile(f.value)
+		if err != nil {
+			return fieldFilter{}, errors.Wrapf(err, "invalid regular expression in field filter %q", s)
+		}
+		f.re = re
+	}
+	return f, nil
+}
+
+// documentFilters parses the repeatable "field-filter" and "array-match"
+// flags.
+func documentFilters(cmd *cobra.Command) ([]documentFilter, error) {
+	values, err := cmd.Flags().GetStringArray("field-filter")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get flag \"field-filter\"")
+	}
+	matches, err := cmd.Flags().GetStringArray("array-match")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get flag \"array-match\"")
+	}
+	filters := make([]documentFilter, 0, len(values)+len(matches))
+	for _, v := range values {
+		f, err := parseFieldFilter(v)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+	for _, v := range matches {
+		f, err := parseArrayMatch(v)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+	if verbose && len(matches) > 0 {
+		fmt.Fprintln(os.Stderr, "note: --array-match is a client-side scan, every document of the query is fetched and billed, not only the matching ones")
+	}
+	return filters, nil
+}
+
+// match reports whether the document field matches the filter. Documents
+// without the field only match negated filters.
+func (f fieldFilter) match(doc *firestore.DocumentSnapshot) bool {
+	value, err := doc.DataAtPath(f.path)
+	if err != nil {
+		return f.op == "!~="
+	}
+	s, ok := value.(string)
+	if !ok {
+		s = fmt.Sprint(outputValue(value))
+	}
+	switch f.op {
+	case "~=":
+		return f.re.MatchString(s)
+	case "!~=":
+		return !f.re.MatchString(s)
+	default:
+		return strings.Contains(s, f.value)
+	}
+}
+
+// arrayMatch is a filter on arrays of maps, which firestore can not query:
+// it matches documents with an array element whose fields match all
+// conditions.
+type arrayMatch struct {
+	path       []string
+	conditions []elementCondition
+}
+
+// elementCondition compares a field of an array element, or the element
+// itself if the path is empty, with a value. String fields are compared with
+// the value as given, so "sku==123" matches the string "123".
+type elementCondition struct {
+	path  []string
+	op    string
+	value interface{}
+	raw   string
+}
+
+// parseArrayMatch parses a filter of the form "items[].sku==ABC". Further
+// conditions on the same element are joined with &&, as in
+// "items[].sku==ABC && items[].qty>=2". The operators are ==, !=, <, <=, >
+// and >=, values are inferred like where values.
+func parseArrayMatch(s string) (arrayMatch, error) {
+	var m arrayMatch
+	for _, part := range strings.Split(s, "&&") {
+		part = strings.TrimSpace(part)
+		i := strings.Index(part, "[]")
+		if i <= 0 {
+			return arrayMatch{}, fmt.Errorf("invalid array match %q, expected array[].field operator value", s)
+		}
+		path := strings.Split(part[:i], ".")
+		if m.path != nil && strings.Join(path, ".") != strings.Join(m.path, ".") {
+			return arrayMatch{}, fmt.Errorf("invalid array match %q, all conditions must be on the same array", s)
+		}
+		m.path = path
+		rest := part[i+2:]
+		j, op := -1, ""
+		for _, o := range symbolOperators {
+			if k := strings.Index(rest, o); k >= 0 && (j < 0 || k < j) {
+				j, op = k, o
+			}
+		}
+		if j < 0 {
+			return arrayMatch{}, fmt.Errorf("invalid array match %q, expected one of the operators %s", s, strings.Join(symbolOperators, " "))
+		}
+		raw := strings.TrimSpace(rest[j+len(op):])
+		c := elementCondition{op: op, value: parseValue(raw), raw: raw}
+		if field := strings.TrimSpace(rest[:j]); field != "" {
+			if !strings.HasPrefix(field, ".") || len(field) == 1 {
+				return arrayMatch{}, fmt.Errorf("invalid array match %q, expected array[].field operator value", s)
+			}
+			c.path = strings.Split(field[1:], ".")
+		}
+		m.conditions = append(m.conditions, c)
+	}
+	return m, nil
+}
+
+// match reports whether an element of the document array matches all
+// conditions. Documents without the array do not match.
+func (m arrayMatch) match(doc *firestore.DocumentSnapshot) bool {
+	value, err := doc.DataAtPath(m.path)
+	if err != nil {
+		return false
+	}
+	elements, ok := value.([]interface{})
+	if !ok {
+		return false
+	}
+	for _, e := range elements {
+		if m.matchElement(e) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m arrayMatch) matchElement(element interface{}) bool {
+	for _, c := range m.conditions {
+		value := element
+		for _, key := range c.path {
+			fields, ok := value.(map[string]interface{})
+			if !ok {
+				return false
+			}
+			if value, ok = fields[key]; !ok {
+				return false
+			}
+		}
+		if !c.compare(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// compare applies the operator of the condition to the value. Values of
+// different types are only ever unequal, numbers compare regardless of
+// being ints or floats.
+func (c elementCondition) compare(value interface{}) bool {
+	want := c.value
+	if _, ok := value.(string); ok {
+		want = c.raw
+	}
+	cmp, ok := compareValues(value, want)
+	switch c.op {
+	case "==":
+		return ok && cmp == 0
+	case "!=":
+		return !ok || cmp != 0
+	case "<":
+		return ok && cmp < 0
+	case "<=":
+		return ok && cmp <= 0
+	case ">":
+		return ok && cmp > 0
+	default:
+		return ok && cmp >= 0
+	}
+}
+
+// compareValues compares two values of the same type, ok is false if they
+// are not comparable.
+func compareValues(a, b interface{}) (cmp int, ok bool) {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	}
+	switch x := a.(type) {
+	case string:
+		y, ok := b.(string)
+		return strings.Compare(x, y), ok
+	case bool:
+		y, ok := b.(bool)
+		if !ok || x == y {
+			return 0, ok
+		}
+		if y {
+			return -1, true
+		}
+		return 1, true
+	case time.Time:
+		y, ok := b.(time.Time)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x.Before(y):
+			return -1, true
+		case x.After(y):
+			return 1, true
+		}
+		return 0, true
+	case nil:
+		return 0, b == nil
+	}
+	return 0, false
+}
+
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// matchAll reports whether the document matches all filters.
+func matchAll(filters []documentFilter, doc *firestore.DocumentSnapshot) bool {
+	for _, f := range filters {
+		if !f.match(doc) {
+			return false
+		}
+	}
+	return true
+}
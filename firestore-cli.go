@@ -4,47 +4,223 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
-	"strconv"
+	"os/signal"
+	"reflect"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/firestore"
 	"github.com/mitchellh/go-homedir"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 var rootCtx context.Context
 var client *firestore.Client
 var verbose, emulator bool
 
+// out receives the command results, stdout unless --out-file is given.
+var out io.Writer = os.Stdout
+var outFile *os.File
+
+// defaultLimit is the number of documents the query commands return without
+// --limit or a limit in the config file.
+const defaultLimit = 100
+
 func init() {
 	cobra.OnInitialize(initConfig)
 	rootCmd.PersistentFlags().StringP("collection", "c", "", "collection path")
-	rootCmd.PersistentFlags().String("project", "", "gcp project id")
+	rootCmd.PersistentFlags().String("collection-group", "", "query all collections with this id instead of --collection")
+	rootCmd.PersistentFlags().String("project", "", "gcp project id, defaults to GOOGLE_CLOUD_PROJECT or GCLOUD_PROJECT")
+	rootCmd.PersistentFlags().String("database", firestore.DefaultDatabaseID, "named firestore database of the project")
+	rootCmd.PersistentFlags().String("profile", "", "named profile from the config file to use")
+	rootCmd.PersistentFlags().String("emulator-host", "", "firestore emulator host, e.g. localhost:8080 (overrides FIRESTORE_EMULATOR_HOST)")
+	rootCmd.PersistentFlags().String("credentials", "", "service account key file (alias --key-file)")
+	rootCmd.PersistentFlags().Bool("project-from-credentials", false, "take the project id from the credentials file if --project is not set")
+	rootCmd.SetGlobalNormalizationFunc(func(_ *pflag.FlagSet, name string) pflag.NormalizedName {
+		if name == "key-file" {
+			name = "credentials"
+		}
+		return pflag.NormalizedName(name)
+	})
 	rootCmd.PersistentFlags().BoolP("prettyprint", "p", false, "pretty print document json")
+	rootCmd.PersistentFlags().Bool("compact", false, "print single line json, overrides prettyprint from config")
 	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "verbose mode")
+	rootCmd.PersistentFlags().BoolP("quiet", "q", false, "suppress informational output, overrides --verbose")
+	rootCmd.PersistentFlags().Int("retries", 2, "retries of requests failing with transient errors")
+	rootCmd.PersistentFlags().Duration("timeout", 5*time.Second, "timeout for firestore requests, 0 for no timeout")
+	rootCmd.PersistentFlags().Bool("include-id", false, "include the document id as \"_id\" in document json")
+	rootCmd.PersistentFlags().String("types-file", "", "yaml file defining document types for --as")
+	rootCmd.PersistentFlags().String("time-format", "", "format of timestamp fields: rfc3339|rfc3339nano|unix|human or a go time layout like 2006-01-02")
+	rootCmd.PersistentFlags().Bool("flatten", false, "print documents as flat objects with dotted keys for nested fields, e.g. address.city and tags.0")
+	rootCmd.PersistentFlags().Bool("trim", false, "leave out null, empty string, empty array and empty map fields, also nested ones")
+	rootCmd.PersistentFlags().Bool("raw", false, "wrap document data in an envelope with id, path, create and update time")
+	rootCmd.PersistentFlags().Bool("dry-run", false, "print the writes of set, update, delete, delete-query, tx-update, copy, move and import instead of executing them")
+	rootCmd.PersistentFlags().Bool("json-errors", false, "print errors as json objects with error, code and command to stderr")
+	rootCmd.PersistentFlags().String("out-file", "", "write the command output to this file instead of stdout, truncating it")
+	rootCmd.PersistentFlags().StringP("output", "o", "json", "output format: json|yaml|csv|table")
+	rootCmd.PersistentFlags().String("template", "", "print each document with this go text/template, e.g. '{{._id}}: {{.name}}', or @path to read it from a file")
+	rootCmd.PersistentFlags().String("color", "auto", "color table output: auto|always|never, auto colors terminals unless NO_COLOR is set")
+	rootCmd.PersistentFlags().Bool("null-as-missing", true, "csv only: render null fields like missing fields, blank or --missing, false writes null")
+	rootCmd.PersistentFlags().String("missing", "", "cell of fields a document does not have in csv and table output, e.g. '-', blank by default")
+	rootCmd.PersistentFlags().Bool("ndjson", false, "stream newline delimited json, one compact document per line")
 
 	cmds := []*cobra.Command{whereCmd, documentsCmd}
 	for _, cmd := range cmds {
-		cmd.Flags().IntP("limit", "l", 100, "return a maximum of n documents")
-		cmd.Flags().Bool("unlimited", false, "return all documents in collection (warning: use with precaution)")
+		cmd.Flags().IntP("limit", "l", defaultLimit, "return a maximum of n documents, overrides limit from config")
+		cmd.Flags().Bool("unlimited", false, "return all documents in collection (warning: use with precaution), overrides unlimited from config")
+		cmd.Flags().StringSlice("collections", nil, "comma separated collections to run the query on one after another, overrides collections from config")
+		cmd.Flags().Int("max-concurrency", 1, "run the queries of --collections with up to n at a time, the output keeps the collection order")
+		cmd.Flags().Int("max-results", 0, "fetch pages of --limit documents until n documents were returned, --unlimited fetches them in one request")
+		cmd.Flags().Bool("fail-on-empty", false, "exit with an error if no documents were found")
+		cmd.Flags().Bool("emit-cursor", false, "print {\"_cursor\": [...]} with the order-by values of the last document as last line if there are more results")
+		cmd.Flags().Bool("summary", false, "print the number of documents and whether the limit cut the results short to stderr")
+		cmd.Flags().Int("limit-to-last", 0, "return the last n documents of the ordered query, requires --order-by")
+		cmd.Flags().StringSlice("select", nil, "comma separated fields to return, other fields are not retrieved")
+		cmd.Flags().Bool("explain", false, "print the query instead of running it")
+		cmd.Flags().Bool("analyze", false, "run the query with explain analyze and print its metrics, like reads and indexes used, to stderr")
+		cmd.Flags().StringArray("field-filter", nil, "client-side filter on fetched documents: field~=regexp, field!~=regexp or field*=substring (repeatable)")
+		cmd.Flags().StringArray("array-match", nil, "client-side filter on arrays of maps: array[].field operator value, conditions on the same element joined with && (repeatable)")
+	}
+	for _, cmd := range []*cobra.Command{whereCmd, documentsCmd, watchCmd, exportCmd} {
+		cmd.Flags().StringArray("order-by", nil, "sort by field, optionally suffixed with :asc or :desc, __name__ or id sort by document id (repeatable)")
+		cmd.Flags().String("start-after", "", "start after this document id, comma separated order-by field values, or the json array of --emit-cursor")
+		cmd.Flags().String("after-id", "", "start after this document, taking the order-by values from it")
+		cmd.Flags().String("start-at", "", "start at these comma separated order-by field values, inclusive")
+		cmd.Flags().String("end-at", "", "end at these comma separated order-by field values, inclusive")
+	}
+	for _, cmd := range []*cobra.Command{whereCmd, countCmd, aggregateCmd, watchCmd, exportCmd, deleteQueryCmd} {
+		cmd.Flags().StringArray("where", nil, "additional where clause \"field operator value\" (repeatable)")
+		cmd.Flags().String("type", "", "force the type of where values: string|int|float|bool|null|timestamp|ref|geo")
+		cmd.Flags().String("ref", "", "document path or id as reference value of the positional clause, given as \"name operator\"")
+		cmd.Flags().String("ts", "", "rfc3339 timestamp as value of the positional clause, given as \"name operator\"")
+		cmd.Flags().String("geo", "", "geo point \"lat,lng\" as value of the positional clause, given as \"name operator\"")
+		cmd.Flags().Bool("json-value", false, "parse where values as json, e.g. '{\"a\":1}' or '\"two words\"'")
+		cmd.Flags().String("near", "", "approximate proximity filter \"lat,lng,radiusKm\" on --geo-field, selects a bounding box")
+		cmd.Flags().String("geo-field", "location", "geo point field used by --near")
+		cmd.Flags().StringArray("or", nil, "filter \"field operator value\" of which at least one has to match, clauses joined with && all have to match (repeatable)")
+		cmd.Flags().StringArray("field-path", nil, "field name of where clauses to take literally, dots included (repeatable)")
+	}
+	setCmd.Flags().StringP("data", "d", "", "document json, @path reads it from a file (read from stdin if omitted)")
+	setCmd.Flags().Bool("merge", false, "merge the given fields into the document instead of overwriting it")
+	setCmd.Flags().StringSlice("merge-field", nil, "comma separated fields to merge, other fields of the data are ignored")
+	for _, cmd := range []*cobra.Command{getCmd, whereCmd, documentsCmd} {
+		cmd.Flags().String("as", "", "check that documents decode into this type from the --types-file")
+	}
+	getCmd.Flags().Bool("recursive", false, "include the documents of all subcollections under \"_subcollections\"")
+	getCmd.Flags().Int("max-depth", 3, "levels of subcollections included by --recursive")
+	documentsCmd.Flags().String("id-prefix", "", "return only documents whose id starts with this prefix")
+	documentsCmd.Flags().Duration("since", 0, "return the documents whose --time-field is at most this long ago, e.g. 1h, ordered by it")
+	documentsCmd.Flags().String("time-field", "createdAt", "timestamp field --since applies to")
+	documentsCmd.Flags().Bool("count-only", false, "print only the number of documents, respects --limit and --unlimited")
+	updateCmd.Flags().Bool("require-exists", false, "fail with exit code 4 if the document is deleted or modified concurrently")
+	deleteCmd.Flags().Bool("exists-precondition", false, "fail if the document does not exist")
+	deleteQueryCmd.Flags().Bool("confirm", false, "delete without asking for confirmation")
+	deleteQueryCmd.Flags().Int("batch-size", 500, "number of documents deleted per batch")
+	for _, cmd := range []*cobra.Command{updateCmd, txUpdateCmd} {
+		cmd.Flags().StringP("data", "d", "", "json object of fields to update, @path reads it from a file")
+	}
+	for _, cmd := range []*cobra.Command{setCmd, updateCmd, txUpdateCmd} {
+		cmd.Flags().String("data-file", "", "file to read the data json from, - for stdin")
+	}
+	txUpdateCmd.Flags().Bool("upsert", false, "create the document if it does not exist")
+	batchGetCmd.Flags().Bool("ignore-missing", false, "do not fail if some documents do not exist")
+	batchGetCmd.Flags().Int("concurrency", 4, "number of chunks of 100 documents fetched in parallel")
+	exportCmd.Flags().StringP("file", "f", "", "file to export to (default stdout)")
+	exportCmd.Flags().Duration("page-timeout", 0, "read in pages with this timeout each instead of --timeout for the whole export")
+	exportCmd.Flags().Int("page-size", 1000, "documents per page with --page-timeout")
+	importCmd.Flags().StringP("file", "f", "", "newline delimited json file to import (default stdin)")
+	diffCmd.Flags().String("against", "", "collection path to compare the documents of the collection with")
+	for _, cmd := range []*cobra.Command{copyCmd, moveCmd} {
+		cmd.Flags().String("to-collection", "", "target collection path, defaults to the source collection")
+		cmd.Flags().String("to-id", "", "target document id, defaults to the source id")
+	}
+	moveCmd.Flags().Bool("keep-source", false, "do not delete the source document, copying it instead")
+	moveCmd.Flags().Bool("confirm", false, "move without asking for confirmation")
+	copyCmd.Flags().String("to-project", "", "target project, defaults to the configured project")
+	for _, cmd := range []*cobra.Command{exportCmd, importCmd, copyCmd} {
+		cmd.Flags().StringArray("replace-field", nil, "rename a field old=new, dotted paths address nested fields (repeatable)")
+	}
+	copyCmd.Flags().StringSlice("strip-fields", nil, "comma separated fields to leave out of the copy")
+	for _, cmd := range []*cobra.Command{setCmd, importCmd} {
+		cmd.Flags().String("schema", "", "json schema file to validate documents against before writing")
 	}
+	importCmd.Flags().Int("batch-size", 0, "wait for the queued writes to complete every n documents, 0 to only wait at the end")
+	importCmd.Flags().Duration("flush-interval", 0, "wait for the queued writes to complete at this interval, 0 to only wait at the end")
+	importCmd.Flags().Bool("strict", false, "abort the import without writing if any document is invalid")
+	importCmd.Flags().String("id-field", "", "field holding the document id, generated ids are used if empty")
+	countCmd.Flags().Duration("estimate", 0, "count for at most this long, then count up to --estimate-limit, printing \"at least n\" if there are more")
+	countCmd.Flags().Int("estimate-limit", 10000, "documents counted at most when the count of --estimate did not finish in time")
+	aggregateCmd.Flags().Bool("count", false, "count matching documents")
+	aggregateCmd.Flags().StringArray("sum", nil, "sum of a numeric field (repeatable)")
+	aggregateCmd.Flags().StringArray("avg", nil, "average of a numeric field (repeatable)")
 
-	for _, flag := range []string{"collection", "project", "prettyprint"} {
+	for _, flag := range []string{"collection", "collection-group", "project", "database", "profile", "credentials", "project-from-credentials", "emulator-host", "prettyprint", "compact", "quiet", "include-id", "types-file", "time-format", "flatten", "trim", "raw", "dry-run", "json-errors", "out-file", "output", "template", "color", "null-as-missing", "missing", "ndjson", "retries", "timeout"} {
 		err := viper.BindPFlag(flag, rootCmd.PersistentFlags().Lookup(flag))
 		if err != nil {
 			panic(err)
 		}
 	}
 
+	// the collection can be given as first argument where the arguments
+	// tell it apart from the document id and where clause
+	acceptCollectionArg(getCmd, argCount(2))
+	acceptCollectionArg(describeCmd, argCount(2))
+	acceptCollectionArg(existsCmd, argCount(2))
+	acceptCollectionArg(deleteCmd, argCount(2))
+	acceptCollectionArg(setCmd, argCount(2))
+	acceptCollectionArg(copyCmd, argCount(2))
+	acceptCollectionArg(moveCmd, argCount(2))
+	acceptCollectionArg(documentsCmd, argCount(1))
+	acceptCollectionArg(importCmd, argCount(1))
+	acceptCollectionArg(diffCmd, argCount(1))
+	watchCmd.Flags().Duration("for", 0, "stop listening after this duration, e.g. 30s")
+	watchCmd.Flags().Bool("until-match", false, "exit once a document matches the where clauses")
+	for _, cmd := range []*cobra.Command{whereCmd, countCmd, aggregateCmd, watchCmd, exportCmd, deleteQueryCmd} {
+		acceptCollectionArg(cmd, whereCollectionArg(cmd))
+	}
+	for _, cmd := range []*cobra.Command{updateCmd, txUpdateCmd} {
+		acceptCollectionArg(cmd, func(args []string) bool {
+			return len(args) >= 2 && !strings.Contains(args[1], "=")
+		})
+	}
+
 	rootCmd.AddCommand(getCmd)
+	rootCmd.AddCommand(existsCmd)
 	rootCmd.AddCommand(whereCmd)
 	rootCmd.AddCommand(documentsCmd)
-
-	rootCtx = context.Background()
+	rootCmd.AddCommand(setCmd)
+	rootCmd.AddCommand(deleteCmd)
+	rootCmd.AddCommand(deleteQueryCmd)
+	rootCmd.AddCommand(updateCmd)
+	rootCmd.AddCommand(countCmd)
+	rootCmd.AddCommand(aggregateCmd)
+	rootCmd.AddCommand(watchCmd)
+	rootCmd.AddCommand(collectionsCmd)
+	rootCmd.AddCommand(importCmd)
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(batchGetCmd)
+	rootCmd.AddCommand(describeCmd)
+	rootCmd.AddCommand(txUpdateCmd)
+	rootCmd.AddCommand(copyCmd)
+	rootCmd.AddCommand(moveCmd)
+	rootCmd.AddCommand(diffCmd)
+	rootCmd.AddCommand(replCmd)
+	rootCmd.AddCommand(healthCmd)
+	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(completionCmd)
+	if err := rootCmd.RegisterFlagCompletionFunc("collection", completeCollections); err != nil {
+		panic(err)
+	}
 
 	if os.Getenv("FIRESTORE_EMULATOR_HOST") != "" {
 		emulator = true
@@ -63,33 +239,191 @@ Example configuration:
 ----------------------
 project: my-awesome-gcp-project
 collection: my_documents
+credentials: /path/to/service-account.json
+limit: 500
+profiles:
+  staging:
+    project: my-awesome-staging-project
 
+You can also use --profile staging to select the settings of a profile.
 You can also use --project and --collection switches to override these settings.
 `
 
 func initConfig() {
 	home, err := homedir.Dir()
 	if err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 	viper.SetConfigName("firestore-cli")
 	viper.AddConfigPath(".")
 	viper.AddConfigPath(home)
 	viper.AddConfigPath(home + "/.config/firestore-cli")
+	if viper.GetBool("json-errors") {
+		// the json error is all that is printed on failure
+		rootCmd.SilenceUsage = true
+	}
 	err = viper.ReadInConfig()
 	if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-		fmt.Print(configNotFound)
+		if !viper.GetBool("quiet") && !requiredParamsFromFlags() {
+			fmt.Fprint(os.Stderr, configNotFound)
+		}
 	} else if err != nil {
 		panic(fmt.Errorf("Fatal error config file: %s \n", err))
 	}
+
+	if profile := viper.GetString("profile"); profile != "" {
+		if err := applyProfile(profile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	// --project-from-credentials asks for the credentials file explicitly
+	if viper.GetString("project") == "" && !viper.GetBool("project-from-credentials") {
+		projectFromEnv()
+	}
 }
 
+// projectEnvVars are the environment variables other gcp tools take the
+// project from, in order of precedence.
+var projectEnvVars = []string{"GOOGLE_CLOUD_PROJECT", "GCLOUD_PROJECT"}
+
+// projectSource tells where the project came from when it was not given with
+// --project or in the config file.
+var projectSource string
+
+// projectFromEnv sets the project from the first of the project environment
+// variables that is set.
+func projectFromEnv() {
+	for _, name := range projectEnvVars {
+		if project := os.Getenv(name); project != "" {
+			viper.Set("project", project)
+			projectSource = "environment variable " + name
+			return
+		}
+	}
+}
+
+// projectOrigin describes where the configured project came from.
+func projectOrigin() string {
+	switch {
+	case projectSource != "":
+		return projectSource
+	case rootCmd.PersistentFlags().Changed("project"):
+		return "flag"
+	case viper.GetString("profile") != "" && viper.IsSet("profiles."+viper.GetString("profile")+".project"):
+		return "profile " + viper.GetString("profile")
+	case viper.GetString("project") != "":
+		return "config file"
+	}
+	return ""
+}
+
+// requiredParamsFromFlags reports whether project and collection were both
+// given on the command line, making a config file unnecessary.
+func requiredParamsFromFlags() bool {
+	flags := rootCmd.PersistentFlags()
+	return flags.Changed("project") && flags.Changed("collection")
+}
+
+// applyProfile overrides the top-level configuration with the settings of the
+// named profile. Flags given on the command line still take precedence.
+func applyProfile(name string) error {
+	settings := viper.GetStringMap("profiles." + name)
+	if len(settings) == 0 {
+		return fmt.Errorf("profile %s not found in config file", name)
+	}
+	for key, value := range settings {
+		if flag := rootCmd.PersistentFlags().Lookup(key); flag != nil && flag.Changed {
+			continue
+		}
+		viper.Set(key, value)
+	}
+	return nil
+}
+
+// Exit codes of the cli, scripts can rely on these.
+const (
+	exitOK               = 0
+	exitError            = 1
+	exitNotFound         = 2
+	exitPermissionDenied = 3
+	exitPrecondition     = 4
+	exitInterrupted      = 130
+)
+
 func main() {
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	// errors are printed below, in the format chosen with --json-errors
+	rootCmd.SilenceErrors = true
+	// ctrl-c cancels the requests in flight, the commands return what they
+	// have so far
+	var stop context.CancelFunc
+	rootCtx, stop = signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	cmd, err := rootCmd.ExecuteC()
+	if outFile != nil {
+		if closeErr := outFile.Close(); err == nil && closeErr != nil {
+			err = errors.Wrap(closeErr, "unable to close output file")
+		}
+	}
+	if err != nil {
+		if viper.GetBool("json-errors") {
+			printJSONError(cmd, err)
+		} else if !errors.As(err, &silentError{}) || verbose {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(exitCode(err))
+	}
+}
+
+// silentError is an error only told by the exit code, unless in verbose mode.
+type silentError struct {
+	error
+}
+
+func (e silentError) Unwrap() error {
+	return e.error
+}
+
+// printJSONError prints the error with its grpc status code and the failed
+// command as a json object to stderr.
+func printJSONError(cmd *cobra.Command, err error) {
+	code := codes.Unknown
+	if s, ok := status.FromError(err); ok {
+		code = s.Code()
+	} else if errors.Is(err, context.DeadlineExceeded) {
+		code = codes.DeadlineExceeded
+	}
+	jsonData, _ := json.Marshal(map[string]string{
+		"error":   err.Error(),
+		"code":    code.String(),
+		"command": cmd.CommandPath(),
+	})
+	fmt.Fprintln(os.Stderr, string(jsonData))
+}
+
+// exitCode maps an error to the exit code of the cli, based on the grpc
+// status of the firestore error it wraps.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	if rootCtx.Err() != nil {
+		return exitInterrupted
 	}
+	s, ok := status.FromError(err)
+	if !ok {
+		return exitError
+	}
+	switch s.Code() {
+	case codes.NotFound:
+		return exitNotFound
+	case codes.PermissionDenied, codes.Unauthenticated:
+		return exitPermissionDenied
+	case codes.FailedPrecondition:
+		return exitPrecondition
+	}
+	return exitError
 }
 
 var rootCmd = &cobra.Command{
@@ -98,70 +432,418 @@ var rootCmd = &cobra.Command{
 }
 
 func preRunE(cmd *cobra.Command, _ []string) error {
-	err := validateRequiredParams()
+	return initCommand(cmd, "project", "collection")
+}
+
+// queryPreRunE is preRunE for commands that query documents, which can run
+// on a collection group instead of a collection.
+func queryPreRunE(cmd *cobra.Command, _ []string) error {
+	if cmd.Flags().Lookup("collections") != nil {
+		return initCommand(cmd, "project", "collection|collection-group|collections")
+	}
+	return initCommand(cmd, "project", "collection|collection-group")
+}
+
+// projectPreRunE is preRunE for commands that do not operate on a collection.
+func projectPreRunE(cmd *cobra.Command, _ []string) error {
+	return initCommand(cmd, "project")
+}
+
+// documentPreRunE is preRunE for commands taking a document id, which can also
+// be given as a full document path, making the collection optional.
+func documentPreRunE(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 && strings.Contains(args[0], "/") {
+		return initCommand(cmd, "project")
+	}
+	return preRunE(cmd, args)
+}
+
+// configPreRunE is preRunE for commands that only read the configuration,
+// they need neither a project nor a client.
+func configPreRunE(cmd *cobra.Command, _ []string) error {
+	return initSettings(cmd)
+}
+
+func initCommand(cmd *cobra.Command, required ...string) error {
+	if err := initSettings(cmd); err != nil {
+		return err
+	}
+	err := validateRequiredParams(required...)
 	if err != nil {
 		return errors.Wrap(err, "unable to validate required params")
 	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "{\"ProjectID\":\"%s\", \"Source\":\"%s\"}\n", viper.GetString("project"), projectOrigin())
+	}
+	if collectionPath := viper.GetString("collection"); collectionPath != "" {
+		if err := validatePath(collectionPath, true); err != nil {
+			return err
+		}
+	}
 
+	// a repl session keeps the client connected between commands
+	if client != nil {
+		return nil
+	}
+	err = initFirestoreClient()
+	if err != nil {
+		return errors.Wrap(err, "unable to create firestore client")
+	}
+	return nil
+}
+
+// initSettings applies the flags and the config file shared by all commands:
+// verbosity, the output file, the query limits and the project.
+func initSettings(cmd *cobra.Command) error {
+	var err error
 	verbose, err = cmd.Flags().GetBool("verbose")
 	if err != nil {
 		return errors.Wrap(err, "unable to get flag \"verbose\"")
 	}
+	if viper.GetBool("quiet") {
+		verbose = false
+	}
 
-	err = initFirestoreClient()
+	if cmd.Flags().Changed("prettyprint") && viper.GetBool("compact") {
+		return errors.New("prettyprint can not be combined with --compact")
+	}
+	if err := openOutFile(); err != nil {
+		return err
+	}
+
+	// the limit and collections flags are local to the query commands, bind the ones of the
+	// running command so they override the config file
+	for _, flag := range []string{"limit", "unlimited", "collections"} {
+		if f := cmd.Flags().Lookup(flag); f != nil {
+			if err := viper.BindPFlag(flag, f); err != nil {
+				return errors.Wrapf(err, "unable to bind flag \"%s\"", flag)
+			}
+		}
+	}
+
+	if viper.GetString("project") == "" && viper.GetBool("project-from-credentials") {
+		if err := inferProject(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openOutFile directs the command output to the file given with --out-file.
+// A previously opened file, e.g. of an earlier repl command, is closed.
+func openOutFile() error {
+	if outFile != nil {
+		_ = outFile.Close()
+		outFile = nil
+		out = os.Stdout
+	}
+	path := viper.GetString("out-file")
+	if path == "" {
+		return nil
+	}
+	f, err := os.Create(path)
 	if err != nil {
-		return errors.Wrap(err, "unable to create firestore client")
+		return errors.Wrap(err, "unable to create output file")
+	}
+	outFile, out = f, f
+	return nil
+}
+
+// inferProject sets the project to the project_id of the service account key
+// given with --credentials.
+func inferProject() error {
+	credentials := viper.GetString("credentials")
+	if credentials == "" {
+		return errors.New("project undefined and no credentials file to take it from")
+	}
+	jsonData, err := ioutil.ReadFile(credentials)
+	if err != nil {
+		return errors.Wrap(err, "unable to read credentials file")
+	}
+	var key struct {
+		ProjectID string `json:"project_id"`
+	}
+	if err := json.Unmarshal(jsonData, &key); err != nil {
+		return errors.Wrap(err, "unable to unmarshal credentials file")
+	}
+	if key.ProjectID == "" {
+		return fmt.Errorf("credentials file %s has no project_id", credentials)
+	}
+	viper.Set("project", key.ProjectID)
+	projectSource = "credentials file " + credentials
+	return nil
+}
+
+// validatePath checks that a slash separated path has no empty segments and
+// the right parity: collection paths have an odd number of segments
+// (users/abc/orders), document paths an even number (users/abc).
+func validatePath(path string, isCollection bool) error {
+	segments := strings.Split(path, "/")
+	for _, segment := range segments {
+		if segment == "" {
+			return fmt.Errorf("invalid path %q, empty segment", path)
+		}
+	}
+	if isCollection && len(segments)%2 == 0 {
+		return fmt.Errorf("invalid collection path %q, expected an odd number of segments", path)
+	}
+	if !isCollection && len(segments)%2 != 0 {
+		return fmt.Errorf("invalid document path %q, expected an even number of segments", path)
 	}
 	return nil
 }
 
-func validateRequiredParams() error {
-	for _, key := range []string{"project", "collection"} {
-		if viper.GetString(key) == "" {
-			return fmt.Errorf("%s undefined", key)
+// validateRequiredParams checks that the given keys are defined. A key of the
+// form "a|b" requires at least one of the alternatives to be defined.
+func validateRequiredParams(keys ...string) error {
+	for _, key := range keys {
+		alternatives := strings.Split(key, "|")
+		defined := false
+		for _, alternative := range alternatives {
+			if viper.GetString(alternative) != "" || len(viper.GetStringSlice(alternative)) > 0 {
+				defined = true
+			}
+		}
+		if !defined {
+			return fmt.Errorf("%s undefined", strings.Join(alternatives, " or "))
 		}
 	}
 	return nil
 }
 
+// withTimeout returns a context for firestore requests that expires after
+// the configured timeout. A timeout of 0 means no timeout.
+func withTimeout() (context.Context, context.CancelFunc) {
+	timeout := viper.GetDuration("timeout")
+	if timeout <= 0 {
+		return context.WithCancel(rootCtx)
+	}
+	return context.WithTimeout(rootCtx, timeout)
+}
+
 func initFirestoreClient() error {
+	// the firestore client picks up the emulator from the environment
+	if host := viper.GetString("emulator-host"); host != "" {
+		if err := os.Setenv("FIRESTORE_EMULATOR_HOST", host); err != nil {
+			return errors.Wrap(err, "unable to set FIRESTORE_EMULATOR_HOST")
+		}
+		emulator = true
+	}
+
+	if verbose {
+		fmt.Fprintf(os.Stderr, "{\"CredentialSource\":\"%s\", \"Database\":\"%s\"}\n",
+			credentialSource(viper.GetString("credentials")),
+			viper.GetString("database"))
+	}
+
 	var err error
-	client, err = firestore.NewClient(rootCtx, viper.GetString("project"))
-	return errors.Wrap(err, "unable to create firestore client")
+	client, err = newClient(viper.GetString("project"))
+	return err
+}
+
+// newClient creates a firestore client for the configured database of the
+// project with the configured credentials.
+func newClient(project string) (*firestore.Client, error) {
+	var opts []option.ClientOption
+	if credentials := viper.GetString("credentials"); credentials != "" {
+		opts = append(opts, option.WithAuthCredentialsFile(option.ServiceAccount, credentials))
+	}
+	database := viper.GetString("database")
+	if database == "" {
+		database = firestore.DefaultDatabaseID
+	}
+	// the client outlives commands interrupted in a repl session
+	c, err := firestore.NewClientWithDatabase(context.Background(), project, database, opts...)
+	return c, errors.Wrap(err, "unable to create firestore client")
+}
+
+// credentialSource describes where the credentials used by the client come
+// from. An explicitly configured file takes precedence over the environment.
+func credentialSource(credentials string) string {
+	if credentials != "" {
+		return "credentials file " + credentials
+	}
+	if env := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); env != "" {
+		return "GOOGLE_APPLICATION_CREDENTIALS " + env
+	}
+	return "application default credentials"
 }
 
 var getCmd = &cobra.Command{
-	Use:     "get [document id]",
-	Short:   "get a document by id",
+	Use:   "get [collection] [document id]",
+	Short: "get a document by id",
+	Long: `the document can also be given as a full document path, in which case the
+collection is not needed. with --recursive the documents of its subcollections
+are nested under "_subcollections", by collection id, down to --max-depth.
+
+examples:
+firestore-cli get 22da76b6
+firestore-cli get users 22da76b6
+firestore-cli get users/abc/orders/22da76b6
+firestore-cli get 22da76b6 --recursive --max-depth 2`,
 	Args:    cobra.ExactArgs(1),
-	PreRunE: preRunE,
+	PreRunE: documentPreRunE,
 	RunE:    get,
 }
 
-func get(_ *cobra.Command, args []string) error {
+func get(cmd *cobra.Command, args []string) error {
 	documentID := args[0]
+	recursive, err := cmd.Flags().GetBool("recursive")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"recursive\"")
+	}
+	maxDepth, err := cmd.Flags().GetInt("max-depth")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"max-depth\"")
+	}
 	if verbose {
-		fmt.Printf("{\"ProjectID\":\"%s\", \"CollectionPath\":\"%s\", \"DocumentID\":\"%s\", \"Emulator\":%t}\n",
+		fmt.Fprintf(os.Stderr, "{\"ProjectID\":\"%s\", \"CollectionPath\":\"%s\", \"DocumentID\":\"%s\", \"Emulator\":%t}\n",
 			viper.GetString("project"),
 			viper.GetString("collection"),
 			documentID,
 			emulator)
 	}
-	docRef := collection().Doc(documentID)
-	ctx, cancelFunc := context.WithTimeout(rootCtx, 5*time.Second)
+	docRef, err := documentRef(documentID)
+	if err != nil {
+		return err
+	}
+	ctx, cancelFunc := withTimeout()
 	defer cancelFunc()
-	docSnap, err := docRef.Get(ctx)
+	var docSnap *firestore.DocumentSnapshot
+	err = retry(ctx, func() error {
+		docSnap, err = docRef.Get(ctx)
+		return err
+	})
+	if status.Code(err) == codes.NotFound {
+		return errors.Wrapf(err, "document %s not found", documentID)
+	}
 	if err != nil {
 		return errors.Wrap(err, "unable to get document")
 	}
 
-	jsonString, err := jsonString(docSnap.Data())
+	t, err := asType(cmd)
 	if err != nil {
 		return err
 	}
+	if t != nil {
+		if err := decodeAs(t, docSnap); err != nil {
+			return errors.Wrapf(err, "document %s does not match the type given with --as", documentID)
+		}
+	}
 
-	fmt.Println(jsonString)
-	return nil
+	docData := documentFields(docSnap)
+	if recursive && maxDepth > 0 {
+		subcollections, err := subcollectionsData(ctx, docRef, maxDepth)
+		if err != nil {
+			return err
+		}
+		if len(subcollections) > 0 {
+			docData["_subcollections"] = subcollections
+		}
+	}
+
+	f, err := newFormatter(out)
+	if err != nil {
+		return err
+	}
+	if err := f.Write(docData); err != nil {
+		return err
+	}
+	return f.Flush()
+}
+
+// subcollectionsData returns the documents of all subcollections of the
+// document by collection id, each with its id as "_id" and its own
+// subcollections as "_subcollections", down to depth levels.
+func subcollectionsData(ctx context.Context, docRef *firestore.DocumentRef, depth int) (map[string]interface{}, error) {
+	colls, err := docRef.Collections(ctx).GetAll()
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to list subcollections of %s", docRef.Path)
+	}
+	subcollections := make(map[string]interface{}, len(colls))
+	for _, coll := range colls {
+		docs, err := coll.Documents(ctx).GetAll()
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to get documents of %s", coll.Path)
+		}
+		docsData := make([]interface{}, 0, len(docs))
+		for _, doc := range docs {
+			docData := documentFields(doc)
+			if !viper.GetBool("raw") {
+				docData["_id"] = doc.Ref.ID
+			}
+			if depth > 1 {
+				nested, err := subcollectionsData(ctx, doc.Ref, depth-1)
+				if err != nil {
+					return nil, err
+				}
+				if len(nested) > 0 {
+					docData["_subcollections"] = nested
+				}
+			}
+			docsData = append(docsData, docData)
+		}
+		subcollections[coll.ID] = docsData
+	}
+	return subcollections, nil
+}
+
+// acceptCollectionArg lets the command take the collection path as optional
+// first argument, overriding --collection and the config. hasCollection tells
+// from the arguments whether the first one is the collection; it is stripped
+// before the arguments are passed on to the command.
+func acceptCollectionArg(cmd *cobra.Command, hasCollection func(args []string) bool) {
+	validateArgs, preRun, run := cmd.Args, cmd.PreRunE, cmd.RunE
+	strip := func(args []string) []string {
+		if hasCollection(args) {
+			return args[1:]
+		}
+		return args
+	}
+	cmd.Args = func(cmd *cobra.Command, args []string) error {
+		if validateArgs == nil {
+			return nil
+		}
+		return validateArgs(cmd, strip(args))
+	}
+	cmd.PreRunE = func(cmd *cobra.Command, args []string) error {
+		if hasCollection(args) {
+			if viper.GetString("collection-group") != "" {
+				return errors.New("collection argument can not be combined with --collection-group")
+			}
+			viper.Set("collection", args[0])
+		}
+		return preRun(cmd, strip(args))
+	}
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		return run(cmd, strip(args))
+	}
+}
+
+// argCount reports whether the first argument is the collection by the
+// number of arguments.
+func argCount(counts ...int) func(args []string) bool {
+	return func(args []string) bool {
+		for _, n := range counts {
+			if len(args) == n {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// whereCollectionArg reports whether the first argument of a command taking a
+// where clause is the collection: with 1 or 4 arguments, or with 3 if the
+// value of the clause is given with --ref, --ts or --geo.
+func whereCollectionArg(cmd *cobra.Command) func(args []string) bool {
+	return func(args []string) bool {
+		if len(args) == 3 {
+			_, typ, err := typedValue(cmd)
+			return err == nil && typ != ""
+		}
+		return len(args) == 1 || len(args) == 4
+	}
 }
 
 func collection() *firestore.CollectionRef {
@@ -169,62 +851,516 @@ func collection() *firestore.CollectionRef {
 	return client.Collection(collectionPath)
 }
 
+// documentRef returns the document with the given id in the collection, or
+// the document at the given path if it contains slashes.
+func documentRef(documentID string) (*firestore.DocumentRef, error) {
+	if !strings.Contains(documentID, "/") {
+		return collection().Doc(documentID), nil
+	}
+	if err := validatePath(documentID, false); err != nil {
+		return nil, err
+	}
+	return client.Doc(documentID), nil
+}
+
+// collectionQuery returns a query for all documents in the collection, or in
+// all collections with the configured collection group id.
+func collectionQuery() firestore.Query {
+	if group := viper.GetString("collection-group"); group != "" {
+		return client.CollectionGroup(group).Query
+	}
+	return collection().Query
+}
+
 var documentsCmd = &cobra.Command{
-	Use:     "documents",
-	Short:   "return all documents in a collection",
-	PreRunE: preRunE,
+	Use:   "documents [collection]",
+	Short: "return all documents in a collection",
+	Long: `returns the documents of a collection, at most --limit unless --unlimited.
+with --max-results the documents are fetched in pages of --limit documents
+until --max-results documents were returned, --unlimited fetches them in one
+request.
+with --collections, or a collections list in the config file, the documents
+of several collections are returned one after another, --limit applies to
+each collection and --max-results to all of them. --max-concurrency runs up to
+n of the queries at a time within a single --timeout.
+--id-prefix selects the documents whose id starts with the prefix as a range
+of ids, relying on firestore ordering document ids lexically.
+--since selects the documents whose --time-field is at most the duration ago,
+ordered by that field unless --order-by is given, for tailing log-like
+collections.
+
+examples:
+firestore-cli documents --limit 10
+firestore-cli documents users --limit 10
+firestore-cli documents --unlimited --count-only
+firestore-cli documents --limit 500 --max-results 10000
+firestore-cli documents --order-by name --after-id 22da76b6
+firestore-cli documents --id-prefix 2024-01
+firestore-cli documents --order-by name --limit 50 --emit-cursor
+firestore-cli documents logs --since 1h --unlimited
+firestore-cli documents events --since 15m --time-field timestamp --order-by timestamp:desc`,
+	PreRunE: queryPreRunE,
 	RunE:    documents,
 }
 
 func documents(cmd *cobra.Command, _ []string) error {
+	clauses, err := sinceClauses(cmd)
+	if err != nil {
+		return err
+	}
 	if verbose {
-		fmt.Printf("{\"ProjectID\":\"%s\", \"CollectionPath\":\"%s\", \"Emulator\":%t}\n",
+		fmt.Fprintf(os.Stderr, "{\"ProjectID\":\"%s\", \"CollectionPath\":\"%s\", \"Emulator\":%t}\n",
 			viper.GetString("project"),
 			viper.GetString("collection"),
 			emulator)
 	}
-	ctx, cancelFunc := context.WithTimeout(rootCtx, 5*time.Second)
-	defer cancelFunc()
-	iter := collection().Documents(ctx)
-	defer iter.Stop()
-	return iterate(cmd, iter)
+	return runQueries(cmd, clauses)
+}
+
+// sinceClauses returns the clause selecting the documents whose "time-field"
+// lies within the "since" duration before now, if given. The documents are
+// ordered by the time field unless the order is given with --order-by.
+func sinceClauses(cmd *cobra.Command) ([]clause, error) {
+	since, err := cmd.Flags().GetDuration("since")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get flag \"since\"")
+	}
+	if since == 0 {
+		return nil, nil
+	}
+	if since < 0 {
+		return nil, fmt.Errorf("invalid since %s, must be positive", since)
+	}
+	timeField, err := cmd.Flags().GetString("time-field")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get flag \"time-field\"")
+	}
+	if timeField == "" {
+		return nil, errors.New("time-field undefined, it is the timestamp field --since applies to")
+	}
+	prefix, err := cmd.Flags().GetString("id-prefix")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get flag \"id-prefix\"")
+	}
+	if prefix != "" {
+		return nil, errors.New("since can not be combined with --id-prefix")
+	}
+	if !cmd.Flags().Changed("order-by") {
+		if err := cmd.Flags().Set("order-by", timeField); err != nil {
+			return nil, errors.Wrap(err, "unable to set flag \"order-by\"")
+		}
+	}
+	return []clause{{path: timeField, op: ">=", value: time.Now().Add(-since).UTC()}}, nil
+}
+
+// results collects the documents printed by a query command, which can run
+// several queries, and prints them in the selected format.
+type results struct {
+	f           formatter
+	filters     []documentFilter
+	countOnly   bool
+	failOnEmpty bool
+	summary     bool
+	analyze     bool
+	count       int
+	filtered    int
+	emitCursor  bool
+	// cursor are the order-by values of the last document if truncated
+	cursor []interface{}
+	// documents are decoded into the type given with --as
+	as         reflect.Type
+	mismatched int
+	// truncated is set when a limit stopped reading before all results
+	truncated bool
+	metrics   []*firestore.ExplainMetrics
+}
+
+func newResults(cmd *cobra.Command) (*results, error) {
+	r := &results{}
+	var err error
+	r.failOnEmpty, err = cmd.Flags().GetBool("fail-on-empty")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse flag \"fail-on-empty\"")
+	}
+	// only the documents command can count
+	if cmd.Flags().Lookup("count-only") != nil {
+		if r.countOnly, err = cmd.Flags().GetBool("count-only"); err != nil {
+			return nil, errors.Wrap(err, "unable to parse flag \"count-only\"")
+		}
+	}
+	if r.summary, err = cmd.Flags().GetBool("summary"); err != nil {
+		return nil, errors.Wrap(err, "unable to parse flag \"summary\"")
+	}
+	if r.analyze, err = cmd.Flags().GetBool("analyze"); err != nil {
+		return nil, errors.Wrap(err, "unable to parse flag \"analyze\"")
+	}
+	if r.filters, err = documentFilters(cmd); err != nil {
+		return nil, err
+	}
+	if r.as, err = asType(cmd); err != nil {
+		return nil, err
+	}
+	if r.emitCursor, err = cmd.Flags().GetBool("emit-cursor"); err != nil {
+		return nil, errors.Wrap(err, "unable to parse flag \"emit-cursor\"")
+	}
+	if r.f, err = newFormatter(out); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// add prints the document unless a field filter drops it, and reports whether
+// it was printed.
+func (r *results) add(doc *firestore.DocumentSnapshot) (bool, error) {
+	if !matchAll(r.filters, doc) {
+		r.filtered++
+		return false, nil
+	}
+	if r.as != nil {
+		if err := decodeAs(r.as, doc); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", doc.Ref.Path, err)
+			r.mismatched++
+		}
+	}
+	if !r.countOnly {
+		if err := r.f.Write(documentFields(doc)); err != nil {
+			return false, err
+		}
+	}
+	r.count++
+	return true, nil
+}
+
+// flush prints the buffered documents, or their number with --count-only.
+func (r *results) flush() error {
+	// in verbose mode tell how many fetched documents were dropped by
+	// field filters, as they are still read and billed
+	if verbose && len(r.filters) > 0 {
+		fmt.Fprintf(os.Stderr, "{\"Fetched\":%d, \"FilteredLocally\":%d}\n", r.count+r.filtered, r.filtered)
+	}
+	if r.countOnly {
+		fmt.Fprintln(out, r.count)
+	} else if err := r.f.Flush(); err != nil {
+		return err
+	}
+	if r.cursor != nil {
+		jsonData, err := json.Marshal(map[string]interface{}{"_cursor": r.cursor})
+		if err != nil {
+			return errors.Wrap(err, "unable to marshal cursor to json")
+		}
+		fmt.Fprintln(out, string(jsonData))
+	}
+	if r.summary {
+		fmt.Fprintf(os.Stderr, "{\"count\": %d, \"truncated\": %t}\n", r.count, r.truncated)
+	}
+	r.printMetrics()
+	if r.mismatched > 0 {
+		return fmt.Errorf("%d documents do not match the type given with --as", r.mismatched)
+	}
+	if r.count == 0 && r.failOnEmpty {
+		return status.Error(codes.NotFound, "no documents found")
+	}
+	return nil
 }
 
-func iterate(cmd *cobra.Command, iter *firestore.DocumentIterator) error {
-	limit, err := cmd.Flags().GetInt("limit")
+// runQueries builds the query from the clauses and flags and prints the
+// resulting documents. With --collections the query runs on each of the
+// collections in turn; --max-results then caps the documents of all of them.
+// With --explain the queries are only described.
+func runQueries(cmd *cobra.Command, clauses []clause) error {
+	explainOnly, err := cmd.Flags().GetBool("explain")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"explain\"")
+	}
+	maxResults, err := cmd.Flags().GetInt("max-results")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"max-results\"")
+	}
+	collections := viper.GetStringSlice("collections")
+	if len(collections) > 0 && viper.GetString("collection-group") != "" {
+		return errors.New("collections can not be combined with --collection-group")
+	}
+	for _, c := range collections {
+		if err := validatePath(c, true); err != nil {
+			return err
+		}
+	}
+	if len(collections) == 0 {
+		collections = []string{viper.GetString("collection")}
+	}
+	// the queries are built by setting each collection in the configuration,
+	// restore it so later commands, e.g. in the repl, use the original one
+	defer viper.Set("collection", viper.GetString("collection"))
+
+	r, err := newResults(cmd)
+	if err != nil {
+		return err
+	}
+	if r.analyze && explainOnly {
+		return errors.New("analyze can not be combined with --explain, it runs the query")
+	}
+	if r.analyze && maxResults > 0 {
+		return errors.New("analyze can not be combined with --max-results")
+	}
+	maxConcurrency, err := cmd.Flags().GetInt("max-concurrency")
 	if err != nil {
-		return errors.Wrap(err, "unable to parse flag \"limit\"")
+		return errors.Wrap(err, "unable to get flag \"max-concurrency\"")
+	}
+	if maxConcurrency < 1 {
+		return fmt.Errorf("invalid max concurrency %d, must be at least 1", maxConcurrency)
+	}
+	if maxConcurrency > 1 && len(collections) > 1 && !explainOnly {
+		if maxResults > 0 {
+			return errors.New("max-concurrency can not be combined with --max-results")
+		}
+		return runParallel(cmd, clauses, collections, r, maxConcurrency)
+	}
+	for _, c := range collections {
+		if maxResults > 0 && r.count >= maxResults {
+			// the remaining collections are not read
+			r.truncated = true
+			break
+		}
+		viper.Set("collection", c)
+		if verbose && len(collections) > 1 {
+			fmt.Fprintf(os.Stderr, "{\"CollectionPath\":\"%s\"}\n", c)
+		}
+		q, err := buildQuery(cmd, clauses)
+		if err != nil {
+			return err
+		}
+		if explainOnly {
+			if err := explain(cmd, q, clauses); err != nil {
+				return err
+			}
+			continue
+		}
+		if maxResults > 0 {
+			err = runPages(cmd, q, r, maxResults-r.count)
+		} else {
+			err = runQuery(cmd, q, r)
+		}
+		if err != nil {
+			// still emit the documents received so far
+			_ = r.f.Flush()
+			return err
+		}
+	}
+	if explainOnly {
+		return nil
+	}
+	return r.flush()
+}
+
+// runQuery runs the query and adds the resulting documents to r, retrying on
+// transient errors as long as no documents were added. With --analyze the
+// query metrics are collected as well.
+func runQuery(cmd *cobra.Command, q firestore.Query, r *results) error {
+	ctx, cancelFunc := withTimeout()
+	defer cancelFunc()
+	return runQueryContext(ctx, cmd, q, r)
+}
+
+// runQueryContext is runQuery within the given context.
+func runQueryContext(ctx context.Context, cmd *cobra.Command, q firestore.Query, r *results) error {
+	limited := false
+	if r.analyze {
+		q, limited = analyzeQuery(cmd, q, r)
 	}
-	unlimited, err := cmd.Flags().GetBool("unlimited")
+	return retry(ctx, func() error {
+		iter := q.Documents(ctx)
+		defer iter.Stop()
+		if err := iterate(cmd, iter, r); err != nil {
+			return err
+		}
+		if r.analyze {
+			r.addMetrics(iter, limited)
+		}
+		return nil
+	})
+}
+
+// iterate adds the documents of the iterator to r, at most --limit unless
+// --unlimited.
+func iterate(cmd *cobra.Command, iter *firestore.DocumentIterator, r *results) error {
+	limit := viper.GetInt("limit")
+	unlimited := viper.GetBool("unlimited")
+	limitToLast, err := cmd.Flags().GetInt("limit-to-last")
 	if err != nil {
-		return errors.Wrap(err, "unable to parse flag \"unlimited\"")
+		return errors.Wrap(err, "unable to parse flag \"limit-to-last\"")
 	}
-	c := 1
+	if limitToLast > 0 {
+		// the query itself is limited
+		unlimited = true
+	}
+	c := 0
+	var last *firestore.DocumentSnapshot
 	for {
 		doc, err := iter.Next()
 		if err == iterator.Done {
 			break
 		}
 		if err != nil {
-			return errors.Wrap(err, "unable to iterate documents")
+			if c == 0 {
+				return iterateError(err)
+			}
+			return noRetry{iterateError(err)}
 		}
-		jsonString, err := jsonString(doc.Data())
+		added, err := r.add(doc)
 		if err != nil {
 			return err
 		}
-		fmt.Println(jsonString)
+		if !added {
+			continue
+		}
+		c++
 		if !unlimited && c >= limit {
+			last = doc
 			break
 		}
-		c++
+	}
+	if last != nil {
+		// the results were only cut short if there are more
+		if _, err := iter.Next(); err == iterator.Done {
+			last = nil
+		}
+	}
+	if last == nil {
+		return nil
+	}
+	r.truncated = true
+	if r.countOnly {
+		return nil
+	}
+	return r.printCursor(cmd, last)
+}
+
+// runPages runs the query page by page with --limit documents per request,
+// adding documents to r until max were added or there are no more results.
+// Each page is read completely before it is added, so failed pages can be
+// retried.
+func runPages(cmd *cobra.Command, q firestore.Query, r *results, max int) error {
+	limit := viper.GetInt("limit")
+	unlimited := viper.GetBool("unlimited")
+	if limitToLast, _ := cmd.Flags().GetInt("limit-to-last"); limitToLast > 0 {
+		return errors.New("max-results can not be combined with --limit-to-last")
+	}
+	if !unlimited && limit <= 0 {
+		return fmt.Errorf("invalid limit %d, must be positive to page", limit)
+	}
+	c, fetched := 0, 0
+	var last *firestore.DocumentSnapshot
+	for c < max {
+		// with --unlimited the rest is fetched in a single request
+		size := max - c
+		if !unlimited && limit < size {
+			size = limit
+		}
+		page := q.Limit(size)
+		if last != nil {
+			page = page.StartAfter(last)
+		}
+		var docs []*firestore.DocumentSnapshot
+		ctx, cancelFunc := withTimeout()
+		err := retry(ctx, func() error {
+			var err error
+			docs, err = page.Documents(ctx).GetAll()
+			return err
+		})
+		cancelFunc()
+		if err != nil {
+			return iterateError(err)
+		}
+		for _, doc := range docs {
+			added, err := r.add(doc)
+			if err != nil {
+				return err
+			}
+			if added {
+				c++
+			}
+		}
+		fetched += len(docs)
+		if len(docs) < size {
+			// no more results
+			last = nil
+			break
+		}
+		last = docs[len(docs)-1]
+		if verbose {
+			fmt.Fprintf(os.Stderr, "fetched %d documents\n", fetched)
+		}
+	}
+	if last == nil {
+		return nil
+	}
+	r.truncated = true
+	if r.countOnly {
+		return nil
+	}
+	return r.printCursor(cmd, last)
+}
+
+// printCursor prints the cursor of the last document of a page to stderr, so
+// it can be passed to --start-after to fetch the next page. With
+// --emit-cursor it is also kept for flush to print as the last line.
+func (r *results) printCursor(cmd *cobra.Command, doc *firestore.DocumentSnapshot) error {
+	orders, err := orderBys(cmd)
+	if err != nil {
+		return err
+	}
+	c, err := cursor(orders, doc)
+	if err != nil {
+		return err
+	}
+	// quoted for the shell, json cursors contain quotes and spaces
+	fmt.Fprintf(os.Stderr, "next page: --start-after '%s'\n", strings.ReplaceAll(c, "'", `'\''`))
+	if r.emitCursor {
+		r.cursor = cursorList(orders, doc)
 	}
 	return nil
 }
 
+// iterateError turns query errors reported by firestore into readable
+// messages. Missing composite indexes (e.g. ordering by a field other than
+// the one used in an inequality) are reported as failed preconditions.
+func iterateError(err error) error {
+	switch status.Code(err) {
+	case codes.FailedPrecondition:
+		return fmt.Errorf("query requires an index: %s", status.Convert(err).Message())
+	case codes.InvalidArgument:
+		return fmt.Errorf("invalid query: %s", status.Convert(err).Message())
+	}
+	return errors.Wrap(err, "unable to iterate documents")
+}
+
+// documentFields returns the document data to output, adding the document
+// id as "_id" if enabled. In raw mode the data is wrapped in an envelope with
+// the snapshot metadata.
+func documentFields(doc *firestore.DocumentSnapshot) map[string]interface{} {
+	docData := outputData(doc.Data())
+	if viper.GetBool("trim") {
+		trimData(docData)
+	}
+	if viper.GetBool("raw") {
+		return map[string]interface{}{
+			"id":         doc.Ref.ID,
+			"path":       doc.Ref.Path,
+			"createTime": doc.CreateTime,
+			"updateTime": doc.UpdateTime,
+			"data":       docData,
+		}
+	}
+	if viper.GetBool("include-id") {
+		docData["_id"] = doc.Ref.ID
+	}
+	return docData
+}
+
 func jsonString(docData map[string]interface{}) (string, error) {
 	var jsonData []byte
 	var err error
-	if viper.GetBool("prettyprint") {
+	if viper.GetBool("prettyprint") && !viper.GetBool("compact") {
 		jsonData, err = json.MarshalIndent(docData, "", "  ")
 	} else {
 		jsonData, err = json.Marshal(docData)
@@ -236,37 +1372,88 @@ func jsonString(docData map[string]interface{}) (string, error) {
 }
 
 var whereCmd = &cobra.Command{
-	Use:   "where [name] [operator] [value]",
+	Use:   "where [collection] [name] [operator] [value]",
 	Short: "query for documents",
-	Long: `examples:
-firestore-cli where correlationId == 22da76b6-95c6-4b8f-8381-a60c65752723`,
-	Args:    cobra.ExactArgs(3),
-	PreRunE: preRunE,
+	Long: `additional conditions can be chained with the repeatable --where flag.
+nested fields are addressed with dotted paths like address.city. field names
+containing dots are quoted with backticks, as in ` + "`" + `a.b` + "`" + `.c, or given with --field-path.
+references, timestamps and geo points are given with --ref, --ts and --geo in
+place of the positional value, or with --type ref|timestamp|geo.
+
+examples:
+firestore-cli where correlationId == 22da76b6-95c6-4b8f-8381-a60c65752723
+firestore-cli where users status == active
+firestore-cli where status == active --order-by createdAt:desc --limit 10 --explain
+firestore-cli where status == active --limit 10 --analyze
+firestore-cli where status == active --where "age > 18"
+firestore-cli where --where "status == active" --where "age > 18"
+firestore-cli where --or "status == active" --or "status == pending && priority > 2"
+firestore-cli where age > 18 --order-by age --order-by name:desc
+firestore-cli where address.city == Berlin
+firestore-cli where version.major == 2 --field-path version.major
+firestore-cli where status == active --order-by age --start-at 18 --end-at 65
+firestore-cli where zip == 01234 --type string
+firestore-cli where createdAt > 2023-01-01T00:00:00Z
+firestore-cli where status == active --select name,address.city
+firestore-cli where tags array-contains urgent
+firestore-cli where tags array-contains-any urgent,important
+firestore-cli where status in active,pending,closed
+firestore-cli where status not-in closed,archived
+firestore-cli where status != closed
+firestore-cli where __name__ ">=" m --where "__name__ < n"
+firestore-cli where tags array-contains --json-value '"two words"'
+firestore-cli where owner == --ref users/abc
+firestore-cli where orders owner == --ref users/abc
+firestore-cli where createdAt ">=" --ts 2023-01-01T00:00:00Z
+firestore-cli where location == --geo 52.52,13.405
+firestore-cli where --near 52.52,13.405,5 --geo-field position
+firestore-cli where status == active --field-filter 'name~=^A'
+firestore-cli where status == open --array-match 'items[].sku==ABC && items[].qty>=2'
+firestore-cli where type == click --collections events_2023,events_2024 --max-results 500
+firestore-cli where age > 18 --order-by age --after-id 22da76b6`,
+	Args:    whereArgs,
+	PreRunE: queryPreRunE,
 	RunE:    where,
 }
 
+// whereArgs accepts either no positional arguments or a single
+// "name operator value" clause. The value can be given with one of the typed
+// value flags instead, leaving "name operator".
+func whereArgs(cmd *cobra.Command, args []string) error {
+	if cmd.Flags().Lookup("ref") != nil {
+		_, typ, err := typedValue(cmd)
+		if err != nil {
+			return err
+		}
+		if typ != "" && len(args) != 2 {
+			return fmt.Errorf("accepts [collection] name operator with --%s, received %d arg(s)", typedValueFlags[typ], len(args))
+		}
+		if len(args) == 2 {
+			// the missing value is reported with the clauses
+			return nil
+		}
+	}
+	if len(args) != 0 && len(args) != 3 {
+		return fmt.Errorf("accepts 0 or 3 arg(s), received %d", len(args))
+	}
+	return nil
+}
+
 func where(cmd *cobra.Command, args []string) error {
-	path := args[0]
-	op := args[1]
-	var value interface{}
-	intValue, err := strconv.ParseInt(args[2], 10, 32)
-	if err == nil {
-		value = intValue
-	} else {
-		value = args[2]
+	clauses, err := whereClauses(cmd, args)
+	if err != nil {
+		return err
+	}
+	if len(clauses) == 0 {
+		return errors.New("no where clause given")
 	}
 
-	if verbose, err := cmd.Flags().GetBool("verbose"); err == nil && verbose {
-		fmt.Printf("{\"ProjectID\":\"%s\", \"CollectionPath\":\"%s\", \"Emulator\":%t, \"Query\":\"%v %v %v\"}",
+	if verbose {
+		fmt.Fprintf(os.Stderr, "{\"ProjectID\":\"%s\", \"CollectionPath\":\"%s\", \"Emulator\":%t, \"Query\":\"%v\"}\n",
 			viper.GetString("project"),
 			viper.GetString("collection"),
 			emulator,
-			path, op, value)
+			clausesString(clauses))
 	}
-	q := collection().Where(path, op, value)
-	ctx, cancelFunc := context.WithTimeout(rootCtx, 5*time.Second)
-	defer cancelFunc()
-	iter := q.Documents(ctx)
-	defer iter.Stop()
-	return iterate(cmd, iter)
+	return runQueries(cmd, clauses)
 }
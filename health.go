@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var healthCmd = &cobra.Command{
+	Use:     "health",
+	Aliases: []string{"ping"},
+	Short:   "check connectivity and credentials",
+	Long: `lists at most one root collection to verify that the project can be reached
+with the configured credentials, and prints OK with the latency. no collection
+has to exist. a failed check exits with the usual exit codes.
+
+examples:
+firestore-cli health
+firestore-cli ping --project my-project --timeout 2s`,
+	Args:    cobra.NoArgs,
+	PreRunE: projectPreRunE,
+	RunE:    health,
+}
+
+func health(_ *cobra.Command, _ []string) error {
+	if verbose {
+		fmt.Fprintf(os.Stderr, "{\"ProjectID\":\"%s\", \"Database\":\"%s\", \"Emulator\":%t}\n",
+			viper.GetString("project"),
+			viper.GetString("database"),
+			emulator)
+	}
+
+	ctx, cancelFunc := withTimeout()
+	defer cancelFunc()
+	start := time.Now()
+	_, err := client.Collections(ctx).Next()
+	latency := time.Since(start)
+	if err != nil && err != iterator.Done {
+		return errors.Wrapf(err, "unable to reach project %q%s", viper.GetString("project"), healthHint(err))
+	}
+	fmt.Fprintf(out, "OK %s\n", latency.Round(time.Millisecond))
+	return nil
+}
+
+// healthHint suggests what to check for common causes of a failed health
+// check.
+func healthHint(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return " (check the network or emulator host, or raise --timeout)"
+	}
+	switch status.Code(err) {
+	case codes.Unauthenticated:
+		return " (check the credentials)"
+	case codes.PermissionDenied:
+		return " (check the permissions of the credentials on the project)"
+	case codes.NotFound:
+		return " (check the project id and database)"
+	case codes.DeadlineExceeded, codes.Unavailable:
+		return " (check the network or emulator host, or raise --timeout)"
+	}
+	return ""
+}
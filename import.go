@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import [collection]",
+	Short: "import newline delimited json documents",
+	Long: `reads one json document per line from stdin or --file and writes them to the
+collection. documents get a generated id, unless --id-field names a field
+holding the id, which is then removed from the written document.
+
+documents can be validated against a json schema with --schema. invalid
+documents are skipped and counted, with --strict all documents are read and
+validated first and nothing is written if any of them is invalid.
+
+writes are sent in batches as they are queued. --batch-size waits for the
+queued writes to complete every n documents, reporting the failed ones, and
+--flush-interval every interval, which bounds the writes in flight for tight
+rate limits or large documents. in verbose mode the throughput is reported at the end. --timeout
+does not apply, the import runs until all documents are written or it is
+interrupted.
+
+examples:
+firestore-cli import --file documents.jsonl
+firestore-cli export | firestore-cli import -c backup --id-field _id
+firestore-cli import --file documents.jsonl --schema user.schema.json --strict
+firestore-cli import --file documents.jsonl --replace-field name=fullName
+firestore-cli import --file documents.jsonl --batch-size 200 --flush-interval 2s -v`,
+	Args:    cobra.NoArgs,
+	PreRunE: preRunE,
+	RunE:    importDocuments,
+}
+
+// importJob is a pending write of the document on the given input line.
+type importJob struct {
+	line int
+	job  *firestore.BulkWriterJob
+}
+
+// importLine is a parsed document of the given input line.
+type importLine struct {
+	line   int
+	docRef *firestore.DocumentRef
+	data   map[string]interface{}
+}
+
+func importDocuments(cmd *cobra.Command, _ []string) error {
+	file, err := cmd.Flags().GetString("file")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"file\"")
+	}
+	idField, err := cmd.Flags().GetString("id-field")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"id-field\"")
+	}
+	strict, err := cmd.Flags().GetBool("strict")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"strict\"")
+	}
+	schema, err := documentSchema(cmd)
+	if err != nil {
+		return err
+	}
+	renames, err := fieldRenames(cmd)
+	if err != nil {
+		return err
+	}
+	batchSize, err := cmd.Flags().GetInt("batch-size")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"batch-size\"")
+	}
+	if batchSize < 0 {
+		return fmt.Errorf("invalid batch size %d, must not be negative", batchSize)
+	}
+	flushInterval, err := cmd.Flags().GetDuration("flush-interval")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"flush-interval\"")
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "{\"ProjectID\":\"%s\", \"CollectionPath\":\"%s\", \"File\":\"%s\", \"Emulator\":%t}\n",
+			viper.GetString("project"),
+			viper.GetString("collection"),
+			file,
+			emulator)
+	}
+
+	var r io.Reader = os.Stdin
+	if file != "" && file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return errors.Wrap(err, "unable to open import file")
+		}
+		defer f.Close()
+		r = f
+	}
+
+	// the bulk writer runs until all documents are written, --timeout would
+	// cut large imports short
+	ctx, cancelFunc := context.WithCancel(rootCtx)
+	defer cancelFunc()
+	start := time.Now()
+	bw := client.BulkWriter(ctx)
+	if flushInterval > 0 {
+		// the bulk writer can be flushed while writes are queued
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+		go func() {
+			for {
+				select {
+				case <-ticker.C:
+					bw.Flush()
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	dryRun := viper.GetBool("dry-run")
+	var jobs []importJob
+	var pending []importLine
+	written, failed, invalid, planned := 0, 0, 0, 0
+	// drain counts the results of the queued writes, which must be flushed,
+	// and drops them so memory does not grow with the input
+	drain := func() {
+		for _, j := range jobs {
+			if _, err := j.job.Results(); err != nil {
+				fmt.Fprintf(os.Stderr, "line %d: %v\n", j.line, err)
+				failed++
+				continue
+			}
+			written++
+		}
+		jobs = jobs[:0]
+	}
+	queued := 0
+	write := func(l importLine) error {
+		if dryRun {
+			planned++
+			return printDryRun("set", l.docRef, l.data)
+		}
+		job, err := bw.Set(l.docRef, l.data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "line %d: %v\n", l.line, err)
+			failed++
+			return nil
+		}
+		jobs = append(jobs, importJob{line: l.line, job: job})
+		queued++
+		if batchSize > 0 && queued%batchSize == 0 {
+			bw.Flush()
+			drain()
+		}
+		return nil
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		docRef, data, err := importDocument(scanner.Bytes(), idField)
+		if err == nil {
+			renameFields(data, renames)
+			err = validateDocument(schema, data)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "line %d: %v\n", line, err)
+			invalid++
+			continue
+		}
+		l := importLine{line: line, docRef: docRef, data: data}
+		if strict {
+			// nothing is written before all documents are known to be valid
+			pending = append(pending, l)
+			continue
+		}
+		if err := write(l); err != nil {
+			bw.End()
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		bw.End()
+		return errors.Wrap(err, "unable to read import file")
+	}
+	if strict && invalid > 0 {
+		bw.End()
+		return fmt.Errorf("import aborted, %d invalid documents", invalid)
+	}
+	for _, l := range pending {
+		if err := write(l); err != nil {
+			bw.End()
+			return err
+		}
+	}
+	bw.End()
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "{\"DryRun\":%d, \"Invalid\":%d}\n", planned, invalid)
+		return nil
+	}
+
+	drain()
+	fmt.Fprintf(os.Stderr, "{\"Written\":%d, \"Failed\":%d, \"Invalid\":%d}\n", written, failed, invalid)
+	if verbose {
+		elapsed := time.Since(start)
+		fmt.Fprintf(os.Stderr, "wrote %d documents in %s, %.1f docs/sec\n", written, elapsed.Round(time.Millisecond), float64(written)/elapsed.Seconds())
+	}
+	if failed > 0 {
+		return fmt.Errorf("unable to import %d documents", failed)
+	}
+	return nil
+}
+
+// importDocument unmarshals a json document and determines its reference,
+// taking the id from idField if given.
+func importDocument(jsonData []byte, idField string) (*firestore.DocumentRef, map[string]interface{}, error) {
+	data, err := parseJSONObject(jsonData)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "unable to unmarshal document json")
+	}
+	if idField == "" {
+		return collection().NewDoc(), data, nil
+	}
+	id, ok := data[idField].(string)
+	if !ok || id == "" {
+		return nil, nil, fmt.Errorf("id field %q missing or not a string", idField)
+	}
+	delete(data, idField)
+	return collection().Doc(id), data, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"cloud.google.com/go/firestore"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var moveCmd = &cobra.Command{
+	Use:   "move [collection] [document id]",
+	Short: "move a document to another collection or id",
+	Long: `creates a copy of the document at the target given by --to-collection and
+--to-id and deletes the source, both in one transaction. the target must not
+exist yet. as deleting the source is destructive --confirm is required, unless
+the move is confirmed at the prompt shown on a terminal. with --keep-source
+the source is left in place. subcollections are not moved.
+
+examples:
+firestore-cli move 22da76b6 --to-id 7c1e40a2 --confirm
+firestore-cli move users 22da76b6 --to-collection archive --confirm
+firestore-cli move users/abc --to-collection archive --dry-run
+firestore-cli move 22da76b6 --to-collection archive --keep-source`,
+	Args:    cobra.ExactArgs(1),
+	PreRunE: documentPreRunE,
+	RunE:    moveDocument,
+}
+
+func moveDocument(cmd *cobra.Command, args []string) error {
+	documentID := args[0]
+	toCollection, err := cmd.Flags().GetString("to-collection")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"to-collection\"")
+	}
+	toID, err := cmd.Flags().GetString("to-id")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"to-id\"")
+	}
+	keepSource, err := cmd.Flags().GetBool("keep-source")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"keep-source\"")
+	}
+	confirmed, err := cmd.Flags().GetBool("confirm")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"confirm\"")
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "{\"ProjectID\":\"%s\", \"CollectionPath\":\"%s\", \"DocumentID\":\"%s\", \"ToCollection\":\"%s\", \"ToID\":\"%s\", \"Emulator\":%t}\n",
+			viper.GetString("project"),
+			viper.GetString("collection"),
+			documentID,
+			toCollection,
+			toID,
+			emulator)
+	}
+
+	source, err := documentRef(documentID)
+	if err != nil {
+		return err
+	}
+	target, err := targetRef(client, documentID, toCollection, toID)
+	if err != nil {
+		return err
+	}
+	if target.Path == source.Path {
+		return errors.New("source and target are the same document, use --to-collection or --to-id")
+	}
+
+	ctx, cancelFunc := withTimeout()
+	defer cancelFunc()
+	if viper.GetBool("dry-run") {
+		docSnap, err := source.Get(ctx)
+		if status.Code(err) == codes.NotFound {
+			return errors.Wrapf(err, "document %s not found", documentID)
+		}
+		if err != nil {
+			return errors.Wrap(err, "unable to get document")
+		}
+		if err := printDryRun("create", target, docSnap.Data()); err != nil {
+			return err
+		}
+		if keepSource {
+			return nil
+		}
+		return printDryRun("delete", source, nil)
+	}
+	if !keepSource && !confirmed {
+		ok, err := confirm(fmt.Sprintf("move %s to %s?", source.Path, target.Path))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("move not confirmed, use --confirm to skip the prompt")
+		}
+	}
+
+	err = client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docSnap, err := tx.Get(source)
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(target, docSnap.Data()); err != nil {
+			return err
+		}
+		if keepSource {
+			return nil
+		}
+		return tx.Delete(source)
+	})
+	switch status.Code(err) {
+	case codes.NotFound:
+		return errors.Wrapf(err, "document %s not found", documentID)
+	case codes.AlreadyExists:
+		return errors.Wrapf(err, "target document %s already exists", target.Path)
+	}
+	if err != nil {
+		return errors.Wrap(err, "unable to move document")
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "moved %s to %s\n", source.Path, target.Path)
+	}
+	return nil
+}
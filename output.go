@@ -0,0 +1,530 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"cloud.google.com/go/firestore"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"go.yaml.in/yaml/v3"
+	"google.golang.org/genproto/googleapis/type/latlng"
+)
+
+// printDryRun prints the write a mutating command would issue instead of
+// issuing it, as a json line with the operation, document path and data.
+func printDryRun(op string, docRef *firestore.DocumentRef, data map[string]interface{}) error {
+	write := map[string]interface{}{"dryRun": op, "path": docRef.Path}
+	if data != nil {
+		write["data"] = outputData(data)
+	}
+	jsonData, err := json.Marshal(write)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal dry run to json")
+	}
+	fmt.Fprintln(out, string(jsonData))
+	return nil
+}
+
+// outputData converts firestore specific values in document data to plain
+// values that render readably in every output format: references become their
+// path, geo points {"lat": ..., "lng": ...} and bytes base64 strings.
+func outputData(docData map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(docData))
+	for k, v := range docData {
+		out[k] = outputValue(v)
+	}
+	return out
+}
+
+func outputValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return outputData(v)
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = outputValue(e)
+		}
+		return out
+	case *firestore.DocumentRef:
+		if v == nil {
+			return nil
+		}
+		return v.Path
+	case *latlng.LatLng:
+		if v == nil {
+			return nil
+		}
+		return map[string]interface{}{"lat": v.Latitude, "lng": v.Longitude}
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	case time.Time:
+		return formatTime(v, viper.GetString("time-format"))
+	case sentinel:
+		return v.output()
+	}
+	if value == nil || !reflect.TypeOf(value).Comparable() {
+		return value
+	}
+	// write sentinels, e.g. in dry runs
+	switch value {
+	case firestore.ServerTimestamp:
+		return "@serverTimestamp"
+	case firestore.Delete:
+		return "@delete"
+	}
+	return value
+}
+
+// trimData removes the fields of the document data that are null, empty
+// strings, empty arrays or empty maps, recursing into maps and arrays. Maps
+// that become empty by trimming are removed as well.
+func trimData(docData map[string]interface{}) {
+	for k, v := range docData {
+		if v = trimValue(v); isEmpty(v) {
+			delete(docData, k)
+		} else {
+			docData[k] = v
+		}
+	}
+}
+
+func trimValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		trimData(v)
+	case []interface{}:
+		// array elements keep their positions, only their fields are trimmed
+		for i, e := range v {
+			v[i] = trimValue(e)
+		}
+	}
+	return value
+}
+
+func isEmpty(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// timeLayouts are the named presets of the "time-format" flag.
+var timeLayouts = map[string]string{
+	"rfc3339":     time.RFC3339,
+	"rfc3339nano": time.RFC3339Nano,
+	"human":       "2006-01-02 15:04:05 MST",
+}
+
+// formatTime formats a timestamp field with a named preset or a go time
+// layout. "unix" gives seconds since the epoch, "human" the local time. Without
+// a format the timestamp is left to the output format.
+func formatTime(t time.Time, format string) interface{} {
+	switch format {
+	case "":
+		return t
+	case "unix":
+		return t.Unix()
+	case "human":
+		return t.Local().Format(timeLayouts[format])
+	}
+	if layout, ok := timeLayouts[format]; ok {
+		return t.Format(layout)
+	}
+	return t.Format(format)
+}
+
+// formatter writes documents to the output in one of the supported formats.
+// Formats that need to know all documents up front, like csv and table,
+// buffer documents until Flush is called.
+type formatter interface {
+	Write(docData map[string]interface{}) error
+	Flush() error
+}
+
+// newFormatter returns a formatter writing to w in the format selected with
+// the "output" flag, flattening documents with --flatten.
+func newFormatter(w io.Writer) (formatter, error) {
+	f, err := outputFormatter(w)
+	if err != nil || !viper.GetBool("flatten") {
+		return f, err
+	}
+	return flattenFormatter{f}, nil
+}
+
+func outputFormatter(w io.Writer) (formatter, error) {
+	output := viper.GetString("output")
+	if viper.GetString("template") != "" {
+		if viper.GetBool("ndjson") || (output != "" && output != "json") {
+			return nil, errors.New("template can not be combined with --ndjson or --output")
+		}
+		return newTemplateFormatter(w)
+	}
+	if viper.GetBool("ndjson") {
+		if output != "" && output != "json" {
+			return nil, fmt.Errorf("ndjson can not be combined with output format %q", output)
+		}
+		bw := bufio.NewWriter(w)
+		return &ndjsonFormatter{w: bw, enc: json.NewEncoder(bw)}, nil
+	}
+	switch output {
+	case "", "json":
+		return &jsonFormatter{w: w}, nil
+	case "yaml":
+		return &yamlFormatter{w: w}, nil
+	case "csv":
+		f := &csvFormatter{rows: rows{missing: viper.GetString("missing")}, w: w}
+		f.null = f.missing
+		if !viper.GetBool("null-as-missing") {
+			f.null = "null"
+		}
+		return f, nil
+	case "table":
+		color, err := useColor(w)
+		if err != nil {
+			return nil, err
+		}
+		return &tableFormatter{rows: rows{missing: viper.GetString("missing")}, w: w, color: color}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q, expected json|yaml|csv|table", output)
+	}
+}
+
+// flattenFormatter turns nested maps and arrays of documents into top-level
+// fields with dotted keys, like "address.city" and "tags.0", before passing
+// them on.
+type flattenFormatter struct {
+	formatter
+}
+
+func (f flattenFormatter) Write(docData map[string]interface{}) error {
+	flat := make(map[string]interface{}, len(docData))
+	for k, v := range docData {
+		flatten(flat, k, v)
+	}
+	return f.formatter.Write(flat)
+}
+
+// flatten adds the value to flat under key, or its elements under dotted keys
+// if it is a non-empty map or array.
+func flatten(flat map[string]interface{}, key string, value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) > 0 {
+			for k, e := range v {
+				flatten(flat, key+"."+k, e)
+			}
+			return
+		}
+	case []interface{}:
+		if len(v) > 0 {
+			for i, e := range v {
+				flatten(flat, key+"."+strconv.Itoa(i), e)
+			}
+			return
+		}
+	}
+	flat[key] = value
+}
+
+type jsonFormatter struct {
+	w io.Writer
+}
+
+func (f *jsonFormatter) Write(docData map[string]interface{}) error {
+	jsonString, err := jsonString(docData)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(f.w, jsonString)
+	return err
+}
+
+func (f *jsonFormatter) Flush() error {
+	return nil
+}
+
+// templateFormatter prints each document with the text/template of the
+// "template" flag. Documents the template fails on are reported on stderr
+// and skipped.
+type templateFormatter struct {
+	w io.Writer
+	t *template.Template
+}
+
+// newTemplateFormatter parses the template given with the "template" flag,
+// or read from the file given as "--template @path".
+func newTemplateFormatter(w io.Writer) (*templateFormatter, error) {
+	text := viper.GetString("template")
+	if strings.HasPrefix(text, "@") {
+		templateData, err := ioutil.ReadFile(text[1:])
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read template file")
+		}
+		text = string(templateData)
+	}
+	t, err := template.New("document").Parse(text)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse template")
+	}
+	return &templateFormatter{w: w, t: t}, nil
+}
+
+func (f *templateFormatter) Write(docData map[string]interface{}) error {
+	var buf bytes.Buffer
+	if err := f.t.Execute(&buf, docData); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to execute template: %v\n", err)
+		return nil
+	}
+	// each document ends a line, unless the template ends it already
+	if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+	_, err := f.w.Write(buf.Bytes())
+	return err
+}
+
+func (f *templateFormatter) Flush() error {
+	return nil
+}
+
+// ndjsonFormatter writes strict newline delimited json, one compact object per
+// line regardless of prettyprint, buffering writes until Flush.
+type ndjsonFormatter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (f *ndjsonFormatter) Write(docData map[string]interface{}) error {
+	return errors.Wrap(f.enc.Encode(docData), "unable to marshal document to json")
+}
+
+func (f *ndjsonFormatter) Flush() error {
+	return f.w.Flush()
+}
+
+type yamlFormatter struct {
+	w io.Writer
+	n int
+}
+
+func (f *yamlFormatter) Write(docData map[string]interface{}) error {
+	yamlData, err := yaml.Marshal(docData)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal document to yaml")
+	}
+	if f.n > 0 {
+		if _, err := fmt.Fprintln(f.w, "---"); err != nil {
+			return err
+		}
+	}
+	f.n++
+	_, err = f.w.Write(yamlData)
+	return err
+}
+
+func (f *yamlFormatter) Flush() error {
+	return nil
+}
+
+// rows buffers documents for the tabular formats and computes the union of
+// their keys as columns.
+type rows struct {
+	docs []map[string]interface{}
+	// null is the cell of null fields, missing the cell of fields a document
+	// does not have
+	null    string
+	missing string
+}
+
+func (r *rows) Write(docData map[string]interface{}) error {
+	r.docs = append(r.docs, docData)
+	return nil
+}
+
+func (r *rows) columns() []string {
+	keys := map[string]bool{}
+	for _, doc := range r.docs {
+		for k := range doc {
+			keys[k] = true
+		}
+	}
+	columns := make([]string, 0, len(keys))
+	for k := range keys {
+		columns = append(columns, k)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// records returns a header row followed by one row per document. Missing
+// fields are blank unless a missing token is set, null fields too unless a
+// null token is set. Without documents there are no records at all.
+func (r *rows) records() ([][]string, error) {
+	if len(r.docs) == 0 {
+		return nil, nil
+	}
+	columns := r.columns()
+	records := [][]string{columns}
+	for _, doc := range r.docs {
+		record := make([]string, len(columns))
+		for i, column := range columns {
+			value, ok := doc[column]
+			if !ok {
+				record[i] = r.missing
+				continue
+			}
+			if value == nil {
+				record[i] = r.null
+				continue
+			}
+			cell, err := cellString(value)
+			if err != nil {
+				return nil, err
+			}
+			record[i] = cell
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// cellString formats a field value for a single csv or table cell, nested
+// values are rendered as compact json.
+func cellString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case map[string]interface{}, []interface{}:
+		jsonData, err := json.Marshal(v)
+		if err != nil {
+			return "", errors.Wrap(err, "unable to marshal field to json")
+		}
+		return string(jsonData), nil
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+type csvFormatter struct {
+	rows
+	w io.Writer
+}
+
+func (f *csvFormatter) Flush() error {
+	records, err := f.records()
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(f.w)
+	return cw.WriteAll(records)
+}
+
+// ansi escape sequences used by the colored table
+const (
+	ansiBold  = "\x1b[1m"
+	ansiDim   = "\x1b[2m"
+	ansiReset = "\x1b[0m"
+)
+
+// useColor reports whether output written to w is colored, as selected with
+// the "color" flag: always, never, or auto to color only terminals, unless
+// the NO_COLOR environment variable is set.
+func useColor(w io.Writer) (bool, error) {
+	switch color := viper.GetString("color"); color {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "", "auto":
+		if os.Getenv("NO_COLOR") != "" {
+			return false, nil
+		}
+		f, ok := w.(*os.File)
+		if !ok {
+			return false, nil
+		}
+		fi, err := f.Stat()
+		return err == nil && fi.Mode()&os.ModeCharDevice != 0, nil
+	default:
+		return false, fmt.Errorf("unknown color mode %q, expected auto|always|never", color)
+	}
+}
+
+type tableFormatter struct {
+	rows
+	w     io.Writer
+	color bool
+}
+
+// Flush prints the rows with aligned columns. With color the header is bold
+// and null fields are shown as a dimmed null.
+func (f *tableFormatter) Flush() error {
+	records, err := f.records()
+	if err != nil {
+		return err
+	}
+	columns := f.columns()
+	// null cells of the records by row and column
+	nulls := map[[2]int]bool{}
+	widths := make([]int, len(columns))
+	for i, record := range records {
+		for j, cell := range record {
+			// keep each row on a single line
+			cell = strings.NewReplacer("\n", " ", "\t", " ").Replace(cell)
+			if f.color && i > 0 {
+				if value, ok := f.docs[i-1][columns[j]]; ok && value == nil {
+					cell = "null"
+					nulls[[2]int{i, j}] = true
+				}
+			}
+			record[j] = cell
+			if n := utf8.RuneCountInString(cell); n > widths[j] {
+				widths[j] = n
+			}
+		}
+	}
+	bw := bufio.NewWriter(f.w)
+	for i, record := range records {
+		for j, cell := range record {
+			padding := ""
+			if j < len(record)-1 {
+				padding = strings.Repeat(" ", widths[j]-utf8.RuneCountInString(cell)+2)
+			}
+			if f.color && i == 0 {
+				cell = ansiBold + cell + ansiReset
+			} else if nulls[[2]int{i, j}] {
+				cell = ansiDim + cell + ansiReset
+			}
+			bw.WriteString(cell + padding)
+		}
+		bw.WriteString("\n")
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/spf13/viper"
+	"google.golang.org/genproto/googleapis/type/latlng"
+)
+
+func TestOutputValue(t *testing.T) {
+	ref := &firestore.DocumentRef{ID: "abc", Path: "projects/p/databases/(default)/documents/users/abc"}
+	geo := &latlng.LatLng{Latitude: 52.52, Longitude: 13.405}
+	createdAt := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		timeFormat string
+		value      interface{}
+		want       interface{}
+	}{
+		{"reference", "", ref, ref.Path},
+		{"nil reference", "", (*firestore.DocumentRef)(nil), nil},
+		{"geo point", "", geo, map[string]interface{}{"lat": 52.52, "lng": 13.405}},
+		{"nil geo point", "", (*latlng.LatLng)(nil), nil},
+		{"bytes", "", []byte("hello"), "aGVsbG8="},
+		{"time", "", createdAt, createdAt},
+		{"time rfc3339", "rfc3339", createdAt, "2024-03-01T12:30:00Z"},
+		{"time unix", "unix", createdAt, createdAt.Unix()},
+		{"time layout", "2006-01-02", createdAt, "2024-03-01"},
+		{"scalar", "", int64(7), int64(7)},
+		{"null", "", nil, nil},
+		{"nested map", "", map[string]interface{}{
+			"owner": ref,
+			"place": map[string]interface{}{"location": geo},
+		}, map[string]interface{}{
+			"owner": ref.Path,
+			"place": map[string]interface{}{"location": map[string]interface{}{"lat": 52.52, "lng": 13.405}},
+		}},
+		{"nested slice", "", []interface{}{ref, []interface{}{[]byte{0xff}}, "x"},
+			[]interface{}{ref.Path, []interface{}{"/w=="}, "x"}},
+	}
+	defer viper.Set("time-format", "")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("time-format", tt.timeFormat)
+			if got := outputValue(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("outputValue(%#v) = %#v, want %#v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutputData(t *testing.T) {
+	doc := map[string]interface{}{
+		"owner":   &firestore.DocumentRef{ID: "abc", Path: "projects/p/databases/(default)/documents/users/abc"},
+		"home":    &latlng.LatLng{Latitude: 1, Longitude: 2},
+		"avatar":  []byte{1, 2, 3},
+		"name":    "Jane",
+		"tags":    []interface{}{"a"},
+		"deleted": nil,
+	}
+	want := map[string]interface{}{
+		"owner":   "projects/p/databases/(default)/documents/users/abc",
+		"home":    map[string]interface{}{"lat": 1.0, "lng": 2.0},
+		"avatar":  "AQID",
+		"name":    "Jane",
+		"tags":    []interface{}{"a"},
+		"deleted": nil,
+	}
+	if got := outputData(doc); !reflect.DeepEqual(got, want) {
+		t.Errorf("outputData = %#v, want %#v", got, want)
+	}
+	if _, ok := doc["owner"].(*firestore.DocumentRef); !ok {
+		t.Error("outputData modified the document data")
+	}
+}
+
+func TestRecordsMissingAndNull(t *testing.T) {
+	docs := []map[string]interface{}{
+		{"name": "Jane", "age": nil},
+		{"name": "John"},
+	}
+	tests := []struct {
+		name          string
+		null, missing string
+		want          [][]string
+	}{
+		{"blank", "", "", [][]string{{"age", "name"}, {"", "Jane"}, {"", "John"}}},
+		{"null token", "null", "", [][]string{{"age", "name"}, {"null", "Jane"}, {"", "John"}}},
+		{"missing token", "", "-", [][]string{{"age", "name"}, {"", "Jane"}, {"-", "John"}}},
+		{"both", "null", "-", [][]string{{"age", "name"}, {"null", "Jane"}, {"-", "John"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := rows{docs: docs, null: tt.null, missing: tt.missing}
+			got, err := r.records()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("records = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutputFormatterMissing(t *testing.T) {
+	docs := []map[string]interface{}{
+		{"name": "Jane", "age": nil},
+		{"name": "John"},
+	}
+	tests := []struct {
+		name          string
+		missing       string
+		nullAsMissing bool
+		want          string
+	}{
+		{"defaults", "", true, "age,name\n,Jane\n,John\n"},
+		{"missing token", "-", true, "age,name\n-,Jane\n-,John\n"},
+		{"null written", "", false, "age,name\nnull,Jane\n,John\n"},
+		{"missing token and null written", "-", false, "age,name\nnull,Jane\n-,John\n"},
+	}
+	defer func() {
+		viper.Set("output", "")
+		viper.Set("missing", "")
+		viper.Set("null-as-missing", true)
+	}()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("output", "csv")
+			viper.Set("missing", tt.missing)
+			viper.Set("null-as-missing", tt.nullAsMissing)
+			var buf bytes.Buffer
+			f, err := outputFormatter(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, doc := range docs {
+				if err := f.Write(doc); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := f.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("csv output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
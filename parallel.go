@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"cloud.google.com/go/firestore"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// bufferFormatter keeps the documents of a query run in parallel until they
+// are written in collection order.
+type bufferFormatter struct {
+	rows
+}
+
+func (f *bufferFormatter) Flush() error {
+	return nil
+}
+
+// fork returns results for a query run in parallel, with the settings of r
+// and the documents buffered.
+func (r *results) fork() *results {
+	s := *r
+	s.f = &bufferFormatter{}
+	s.count, s.filtered, s.mismatched = 0, 0, 0
+	s.truncated = false
+	s.cursor, s.metrics = nil, nil
+	return &s
+}
+
+// merge writes the buffered documents of the forked results to r and adds up
+// their counts.
+func (r *results) merge(s *results) error {
+	for _, doc := range s.f.(*bufferFormatter).docs {
+		if err := r.f.Write(doc); err != nil {
+			return err
+		}
+	}
+	r.count += s.count
+	r.filtered += s.filtered
+	r.mismatched += s.mismatched
+	r.truncated = r.truncated || s.truncated
+	if s.cursor != nil {
+		r.cursor = s.cursor
+	}
+	r.metrics = append(r.metrics, s.metrics...)
+	return nil
+}
+
+// runParallel runs the query on the collections with up to maxConcurrency
+// queries at a time, all within one timeout. The documents are buffered and
+// written in the order of the collections, so the output is the same as when
+// running the queries one after another. If a query fails, the documents of
+// the collections before it and the ones it received are still written.
+func runParallel(cmd *cobra.Command, clauses []clause, collections []string, r *results, maxConcurrency int) error {
+	// the queries are built up front, building reads the collection from
+	// the configuration
+	queries := make([]firestore.Query, len(collections))
+	for i, c := range collections {
+		viper.Set("collection", c)
+		if verbose {
+			fmt.Fprintf(os.Stderr, "{\"CollectionPath\":\"%s\"}\n", c)
+		}
+		q, err := buildQuery(cmd, clauses)
+		if err != nil {
+			return err
+		}
+		queries[i] = q
+	}
+
+	ctx, cancelFunc := withTimeout()
+	defer cancelFunc()
+	forks := make([]*results, len(queries))
+	errs := make([]error, len(queries))
+	sem := make(chan struct{}, maxConcurrency)
+	var wg sync.WaitGroup
+	for i, q := range queries {
+		forks[i] = r.fork()
+		wg.Add(1)
+		go func(i int, q firestore.Query) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			errs[i] = runQueryContext(ctx, cmd, q, forks[i])
+		}(i, q)
+	}
+	wg.Wait()
+
+	for i, fork := range forks {
+		if err := r.merge(fork); err != nil {
+			return err
+		}
+		if errs[i] != nil {
+			_ = r.f.Flush()
+			return errs[i]
+		}
+	}
+	return r.flush()
+}
@@ -0,0 +1,816 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/genproto/googleapis/type/latlng"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// clause is a single "field operator value" query condition.
+type clause struct {
+	path  string
+	op    string
+	value interface{}
+	// fieldPath is the path split into field names, set by whereClauses
+	fieldPath firestore.FieldPath
+}
+
+func (c clause) String() string {
+	switch v := c.value.(type) {
+	case [][]clause:
+		groups := make([]string, len(v))
+		for i, group := range v {
+			groups[i] = clausesString(group)
+		}
+		return "(" + strings.Join(groups, " || ") + ")"
+	case *firestore.DocumentRef:
+		return fmt.Sprintf("%v %v %v", c.path, c.op, v.Path)
+	case *latlng.LatLng:
+		return fmt.Sprintf("%v %v %g,%g", c.path, c.op, v.Latitude, v.Longitude)
+	}
+	return fmt.Sprintf("%v %v %v", c.path, c.op, c.value)
+}
+
+// listOperators take a list of values instead of a single value. They map
+// to the maximum number of values firestore accepts in the list.
+var listOperators = map[string]int{
+	"array-contains-any": 30,
+	"in":                 30,
+	"not-in":             10,
+}
+
+// newClause creates a clause, converting the value to the given type (see
+// parseTypedValue). Operators taking a list get the value parsed as a list.
+func newClause(path, op, value, typ string) (clause, error) {
+	if path == firestore.DocumentID {
+		return documentIDClause(op, value)
+	}
+	if maxValues, ok := listOperators[op]; ok {
+		if op == "array-contains-any" && typ != "json" && !isList(value) {
+			return clause{}, fmt.Errorf("%s expects a list of values like a,b or [\"a\",\"b\"], got %q", op, value)
+		}
+		values, err := parseList(value, typ)
+		if err != nil {
+			return clause{}, err
+		}
+		if len(values) > maxValues {
+			return clause{}, fmt.Errorf("%s supports at most %d values, got %d", op, maxValues, len(values))
+		}
+		return clause{path: path, op: op, value: values}, nil
+	}
+	v, err := parseTypedValue(value, typ)
+	if err != nil {
+		return clause{}, err
+	}
+	return clause{path: path, op: op, value: v}, nil
+}
+
+// documentIDClause creates a clause on the document id. Firestore compares
+// document ids as references, so the values are converted to documents of the
+// collection, or to the documents at the given paths.
+func documentIDClause(op, value string) (clause, error) {
+	ids := []string{value}
+	if maxValues, ok := listOperators[op]; ok {
+		ids = strings.Split(value, ",")
+		if len(ids) > maxValues {
+			return clause{}, fmt.Errorf("%s supports at most %d values, got %d", op, maxValues, len(ids))
+		}
+	}
+	refs := make([]interface{}, len(ids))
+	for i, id := range ids {
+		ref, err := documentRef(id)
+		if err != nil {
+			return clause{}, err
+		}
+		refs[i] = ref
+	}
+	if _, ok := listOperators[op]; ok {
+		return clause{path: firestore.DocumentID, op: op, value: refs}, nil
+	}
+	return clause{path: firestore.DocumentID, op: op, value: refs[0]}, nil
+}
+
+// symbolOperators are the operators that need no spaces around them, longest
+// first so they are found before their prefixes.
+var symbolOperators = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// parseClause parses a clause of the form "field operator value". Everything
+// after the operator is treated as the value. Operators made of symbols can
+// also be written without spaces, as in "age>=18".
+func parseClause(s, typ string) (clause, error) {
+	fields := strings.Fields(s)
+	if len(fields) >= 3 {
+		return newClause(fields[0], fields[1], strings.Join(fields[2:], " "), typ)
+	}
+	for _, op := range symbolOperators {
+		if i := strings.Index(s, op); i > 0 {
+			return newClause(strings.TrimSpace(s[:i]), op, strings.TrimSpace(s[i+len(op):]), typ)
+		}
+	}
+	return clause{}, fmt.Errorf("invalid where clause %q, expected \"field operator value\"", s)
+}
+
+// orClause parses the filters of the repeatable "or" flag into a single
+// clause matching documents that match any of them. A filter can combine
+// clauses with &&, which all have to match.
+func orClause(filters []string, typ string) (clause, error) {
+	if len(filters) < 2 {
+		return clause{}, errors.New("or needs at least two filters, use --where for a single one")
+	}
+	groups := make([][]clause, len(filters))
+	for i, filter := range filters {
+		for _, s := range strings.Split(filter, "&&") {
+			c, err := parseClause(s, typ)
+			if err != nil {
+				return clause{}, err
+			}
+			groups[i] = append(groups[i], c)
+		}
+	}
+	return clause{op: "or", value: groups}, nil
+}
+
+// whereClauses collects the clause given as positional arguments, if any,
+// followed by the clauses given with the repeatable "where" flag.
+func whereClauses(cmd *cobra.Command, args []string) ([]clause, error) {
+	typ, err := cmd.Flags().GetString("type")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get flag \"type\"")
+	}
+	jsonValue, err := cmd.Flags().GetBool("json-value")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get flag \"json-value\"")
+	}
+	if jsonValue {
+		if typ != "" {
+			return nil, errors.New("json-value can not be combined with --type")
+		}
+		typ = "json"
+	}
+	var clauses []clause
+	value, valueType, err := typedValue(cmd)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case valueType != "" && len(args) != 2:
+		return nil, fmt.Errorf("--%s is the value of the positional clause, give it as \"name operator\"", typedValueFlags[valueType])
+	case len(args) == 2 && valueType == "":
+		return nil, errors.New("positional clause has no value, give it as \"name operator value\" or use --ref, --ts or --geo")
+	case len(args) == 2:
+		c, err := newClause(args[0], args[1], value, valueType)
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, c)
+	case len(args) == 3:
+		c, err := newClause(args[0], args[1], args[2], typ)
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, c)
+	}
+	wheres, err := cmd.Flags().GetStringArray("where")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get flag \"where\"")
+	}
+	for _, w := range wheres {
+		c, err := parseClause(w, typ)
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, c)
+	}
+	near, err := nearClauses(cmd)
+	if err != nil {
+		return nil, err
+	}
+	clauses = append(clauses, near...)
+	ors, err := cmd.Flags().GetStringArray("or")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get flag \"or\"")
+	}
+	if len(ors) > 0 {
+		c, err := orClause(ors, typ)
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, c)
+	}
+	literals, err := cmd.Flags().GetStringArray("field-path")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get flag \"field-path\"")
+	}
+	if err := setFieldPaths(clauses, literals); err != nil {
+		return nil, err
+	}
+	if err := validateInequalities(clauses); err != nil {
+		return nil, err
+	}
+	if err := validateNegations(clauses); err != nil {
+		return nil, err
+	}
+	if verbose {
+		for _, note := range missingFieldNotes(clauses) {
+			fmt.Fprintln(os.Stderr, note)
+		}
+	}
+	return clauses, nil
+}
+
+// missingFieldNotes explains for each != and not-in clause that documents
+// without the field do not match it.
+func missingFieldNotes(clauses []clause) []string {
+	var notes []string
+	for _, c := range flatClauses(clauses) {
+		if c.op == "!=" || c.op == "not-in" {
+			notes = append(notes, fmt.Sprintf("note: \"%v\" only matches documents that have the field %s, documents without it are excluded", c, c.path))
+		}
+	}
+	return notes
+}
+
+// typedValueFlags are the flags giving the value of the positional clause
+// with a fixed type, by the type of parseTypedValue.
+var typedValueFlags = map[string]string{
+	"ref":       "ref",
+	"timestamp": "ts",
+	"geo":       "geo",
+}
+
+// typedValue returns the value given with one of the typed value flags and
+// its type, or empty strings if none is set.
+func typedValue(cmd *cobra.Command) (value, typ string, err error) {
+	for t, flag := range typedValueFlags {
+		v, err := cmd.Flags().GetString(flag)
+		if err != nil {
+			return "", "", errors.Wrapf(err, "unable to get flag %q", flag)
+		}
+		if v == "" {
+			continue
+		}
+		if typ != "" {
+			return "", "", errors.New("only one of --ref, --ts and --geo can be given")
+		}
+		value, typ = v, t
+	}
+	return value, typ, nil
+}
+
+// validateNegations rejects combinations of != and not-in that firestore does
+// not allow: a query can have a single not-in filter, which can not be
+// combined with a != filter.
+func validateNegations(clauses []clause) error {
+	notIn, notEqual := 0, 0
+	for _, c := range flatClauses(clauses) {
+		switch c.op {
+		case "not-in":
+			notIn++
+		case "!=":
+			notEqual++
+		}
+	}
+	if notIn > 1 {
+		return errors.New("a query can have only one not-in filter")
+	}
+	if notIn > 0 && notEqual > 0 {
+		return errors.New("not-in can not be combined with != in the same query")
+	}
+	return nil
+}
+
+// kmPerDegree is the length of a degree of latitude in kilometers.
+const kmPerDegree = 111.32
+
+// nearClauses turns the "near" flag of the form "lat,lng,radiusKm" into range
+// clauses on the "geo-field" selecting the bounding box around the point.
+// Firestore orders geo points by latitude, then longitude, so the clauses
+// select the latitude band of the box; the result is a superset of the
+// documents within the radius.
+func nearClauses(cmd *cobra.Command) ([]clause, error) {
+	near, err := cmd.Flags().GetString("near")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get flag \"near\"")
+	}
+	if near == "" {
+		return nil, nil
+	}
+	field, err := cmd.Flags().GetString("geo-field")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get flag \"geo-field\"")
+	}
+	parts := strings.Split(near, ",")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid near %q, expected \"lat,lng,radiusKm\"", near)
+	}
+	var values [3]float64
+	for i, part := range parts {
+		values[i], err = strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid near %q, expected \"lat,lng,radiusKm\"", near)
+		}
+	}
+	lat, lng, radius := values[0], values[1], values[2]
+	if lat < -90 || lat > 90 || lng < -180 || lng > 180 || radius <= 0 {
+		return nil, fmt.Errorf("invalid near %q, latitude, longitude or radius out of range", near)
+	}
+
+	dLat := radius / kmPerDegree
+	dLng := 180.0
+	if cos := math.Cos(lat * math.Pi / 180); cos > 0 {
+		dLng = math.Min(radius/(kmPerDegree*cos), 180)
+	}
+	southWest := &latlng.LatLng{Latitude: math.Max(lat-dLat, -90), Longitude: math.Max(lng-dLng, -180)}
+	northEast := &latlng.LatLng{Latitude: math.Min(lat+dLat, 90), Longitude: math.Min(lng+dLng, 180)}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "note: --near selects documents by latitude %.6f to %.6f, results are approximate and not limited to the radius\n",
+			southWest.Latitude, northEast.Latitude)
+	}
+	return []clause{
+		{path: field, op: ">=", value: southWest},
+		{path: field, op: "<=", value: northEast},
+	}, nil
+}
+
+// inequalityOperators are the operators firestore treats as range or
+// inequality filters.
+var inequalityOperators = map[string]bool{
+	"<":      true,
+	"<=":     true,
+	">":      true,
+	">=":     true,
+	"!=":     true,
+	"not-in": true,
+}
+
+// flatClauses returns the clauses with the clauses of or groups in place of
+// the or clauses, for checks that apply to the query as a whole.
+func flatClauses(clauses []clause) []clause {
+	var flat []clause
+	for _, c := range clauses {
+		groups, ok := c.value.([][]clause)
+		if c.op != "or" || !ok {
+			flat = append(flat, c)
+			continue
+		}
+		for _, group := range groups {
+			flat = append(flat, flatClauses(group)...)
+		}
+	}
+	return flat
+}
+
+// inequalityField returns the first clause with an inequality operator, also
+// within or groups, or nil if there is none.
+func inequalityField(clauses []clause) *clause {
+	for _, c := range flatClauses(clauses) {
+		if inequalityOperators[c.op] {
+			return &c
+		}
+	}
+	return nil
+}
+
+// validateInequalities rejects inequality filters on more than one field,
+// which firestore does not allow in a single query, also within or groups.
+// Several inequalities on the same field, e.g. a range "age > 18" and
+// "age < 65", are fine.
+func validateInequalities(clauses []clause) error {
+	first := inequalityField(clauses)
+	if first == nil {
+		return nil
+	}
+	for _, c := range flatClauses(clauses) {
+		if inequalityOperators[c.op] && c.path != first.path {
+			return fmt.Errorf("inequality filters \"%v\" and \"%v\" are on different fields, "+
+				"firestore allows range and != filters on a single field per query", *first, c)
+		}
+	}
+	return nil
+}
+
+// validateOrders rejects sort orders that do not start with the field of the
+// inequality filters, which firestore requires.
+func validateOrders(clauses []clause, orders []order) error {
+	first := inequalityField(clauses)
+	if first == nil || len(orders) == 0 || orders[0].path == first.path {
+		return nil
+	}
+	return fmt.Errorf("the first --order-by must be %s, the field of the inequality filter \"%v\"", first.path, *first)
+}
+
+// order is a single sort key of a query.
+type order struct {
+	path string
+	dir  firestore.Direction
+}
+
+// parseOrder parses a sort key of the form "field" or "field:asc|desc". The
+// fields "__name__" and "id" sort by document id.
+func parseOrder(s string) (order, error) {
+	o := order{path: s, dir: firestore.Asc}
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		o.path = s[:i]
+		switch strings.ToLower(s[i+1:]) {
+		case "asc":
+		case "desc":
+			o.dir = firestore.Desc
+		default:
+			return order{}, fmt.Errorf("invalid order-by direction in %q, expected asc or desc", s)
+		}
+	}
+	if o.path == "" {
+		return order{}, fmt.Errorf("invalid order-by %q, field name missing", s)
+	}
+	if o.path == "id" {
+		o.path = firestore.DocumentID
+	}
+	return o, nil
+}
+
+// orderBys returns the sort keys given with the repeatable "order-by" flag.
+func orderBys(cmd *cobra.Command) ([]order, error) {
+	values, err := cmd.Flags().GetStringArray("order-by")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get flag \"order-by\"")
+	}
+	orders := make([]order, 0, len(values))
+	for _, v := range values {
+		o, err := parseOrder(v)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, o)
+	}
+	return orders, nil
+}
+
+// buildQuery builds a query on the collection from the given where clauses
+// and the query flags of the command.
+func buildQuery(cmd *cobra.Command, clauses []clause) (firestore.Query, error) {
+	q := applyClauses(collectionQuery(), clauses)
+	orders, err := orderBys(cmd)
+	if err != nil {
+		return q, err
+	}
+	if err := validateOrders(clauses, orders); err != nil {
+		return q, err
+	}
+	for _, o := range orders {
+		q = q.OrderBy(o.path, o.dir)
+	}
+
+	startAfter, err := cmd.Flags().GetString("start-after")
+	if err != nil {
+		return q, errors.Wrap(err, "unable to get flag \"start-after\"")
+	}
+	if startAfter != "" {
+		if len(orders) == 0 {
+			// without an explicit order the cursor is a document id
+			id := startAfter
+			if values := cursorValues(startAfter, nil); strings.HasPrefix(startAfter, "[") && len(values) == 1 {
+				id = fmt.Sprint(values[0])
+			}
+			q = q.OrderBy(firestore.DocumentID, firestore.Asc).StartAfter(id)
+		} else {
+			values := cursorValues(startAfter, orders)
+			if len(values) > len(orders) {
+				return q, fmt.Errorf("start-after has %d values but only %d order-by fields", len(values), len(orders))
+			}
+			q = q.StartAfter(values...)
+		}
+	}
+
+	afterID, err := cmd.Flags().GetString("after-id")
+	if err != nil {
+		return q, errors.Wrap(err, "unable to get flag \"after-id\"")
+	}
+	if afterID != "" {
+		if startAfter != "" {
+			return q, errors.New("after-id can not be combined with --start-after")
+		}
+		doc, err := cursorDocument(afterID)
+		if err != nil {
+			return q, err
+		}
+		// the cursor takes the order-by field values from the snapshot
+		q = q.StartAfter(doc)
+	}
+
+	startAt, err := rangeBound(cmd, "start-at", orders)
+	if err != nil {
+		return q, err
+	}
+	if startAt != nil {
+		if startAfter != "" || afterID != "" {
+			return q, errors.New("start-at can not be combined with --start-after or --after-id")
+		}
+		q = q.StartAt(startAt...)
+	}
+	endAt, err := rangeBound(cmd, "end-at", orders)
+	if err != nil {
+		return q, err
+	}
+	if endAt != nil {
+		q = q.EndAt(endAt...)
+	}
+
+	// only the documents command filters by id prefix
+	if cmd.Flags().Lookup("id-prefix") != nil {
+		prefix, err := cmd.Flags().GetString("id-prefix")
+		if err != nil {
+			return q, errors.Wrap(err, "unable to get flag \"id-prefix\"")
+		}
+		if prefix != "" {
+			if len(orders) > 0 || startAfter != "" || afterID != "" || startAt != nil || endAt != nil {
+				return q, errors.New("id-prefix can not be combined with --order-by, --start-after, --after-id, --start-at or --end-at")
+			}
+			if viper.GetString("collection-group") != "" {
+				return q, errors.New("id-prefix can not be combined with --collection-group")
+			}
+			// document ids are ordered lexically, \uf8ff sorts after the
+			// characters used in ids
+			q = q.OrderBy(firestore.DocumentID, firestore.Asc).StartAt(prefix).EndAt(prefix + "\uf8ff")
+		}
+	}
+
+	if cmd.Flags().Lookup("limit-to-last") != nil {
+		limitToLast, err := cmd.Flags().GetInt("limit-to-last")
+		if err != nil {
+			return q, errors.Wrap(err, "unable to get flag \"limit-to-last\"")
+		}
+		if limitToLast > 0 {
+			if len(orders) == 0 {
+				return q, errors.New("limit-to-last requires --order-by")
+			}
+			if cmd.Flags().Changed("limit") || cmd.Flags().Changed("unlimited") {
+				return q, errors.New("limit-to-last can not be combined with --limit or --unlimited")
+			}
+			q = q.LimitToLast(limitToLast)
+		}
+	}
+
+	// not every query command supports projections
+	if cmd.Flags().Lookup("select") != nil {
+		fields, err := cmd.Flags().GetStringSlice("select")
+		if err != nil {
+			return q, errors.Wrap(err, "unable to get flag \"select\"")
+		}
+		if len(fields) > 0 {
+			q = q.Select(fields...)
+		}
+	}
+	return q, nil
+}
+
+// cursorDocument fetches the snapshot of the document used as a query cursor.
+func cursorDocument(id string) (*firestore.DocumentSnapshot, error) {
+	docRef, err := documentRef(id)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancelFunc := withTimeout()
+	defer cancelFunc()
+	var doc *firestore.DocumentSnapshot
+	err = retry(ctx, func() error {
+		doc, err = docRef.Get(ctx)
+		return err
+	})
+	if status.Code(err) == codes.NotFound {
+		return nil, errors.Wrapf(err, "cursor document %s not found", id)
+	}
+	return doc, errors.Wrap(err, "unable to get cursor document")
+}
+
+// rangeBound parses the order-by field values of the "start-at" or "end-at"
+// flag, one for each order-by field. It returns nil if the flag is empty.
+func rangeBound(cmd *cobra.Command, flag string, orders []order) ([]interface{}, error) {
+	s, err := cmd.Flags().GetString(flag)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get flag %q", flag)
+	}
+	if s == "" {
+		return nil, nil
+	}
+	if len(orders) == 0 {
+		return nil, fmt.Errorf("%s requires --order-by", flag)
+	}
+	values := cursorValues(s, orders)
+	if len(values) != len(orders) {
+		return nil, fmt.Errorf("%s has %d values but there are %d order-by fields", flag, len(values), len(orders))
+	}
+	return values, nil
+}
+
+// cursorValues parses a comma separated list of cursor field values, or a
+// json array as printed by --emit-cursor and the next page hint. Values for
+// document id orders are kept as strings, ids like 123 are not numbers.
+func cursorValues(s string, orders []order) []interface{} {
+	isID := func(i int) bool {
+		return i < len(orders) && orders[i].path == firestore.DocumentID
+	}
+	if strings.HasPrefix(s, "[") {
+		if v, err := parseJSON(s); err == nil {
+			if values, ok := v.([]interface{}); ok {
+				for i, v := range values {
+					// json strings stay strings unless they are timestamps
+					if str, ok := v.(string); ok && !isID(i) {
+						if t, err := time.Parse(time.RFC3339Nano, str); err == nil {
+							values[i] = t
+						}
+					}
+				}
+				return values
+			}
+		}
+	}
+	parts := strings.Split(s, ",")
+	values := make([]interface{}, len(parts))
+	for i, p := range parts {
+		if isID(i) {
+			values[i] = p
+			continue
+		}
+		values[i] = parseValue(p)
+	}
+	return values
+}
+
+// orderValue returns the value of the sort key of the document.
+func orderValue(o order, doc *firestore.DocumentSnapshot) (interface{}, error) {
+	if o.path == firestore.DocumentID {
+		return doc.Ref.ID, nil
+	}
+	return doc.DataAt(o.path)
+}
+
+// cursorList returns the order-by field values of the document, or its id if
+// unordered, as values for json.
+func cursorList(orders []order, doc *firestore.DocumentSnapshot) []interface{} {
+	if len(orders) == 0 {
+		return []interface{}{doc.Ref.ID}
+	}
+	values := make([]interface{}, len(orders))
+	for i, o := range orders {
+		v, _ := orderValue(o, doc)
+		values[i] = cursorValue(v)
+	}
+	return values
+}
+
+// cursorValue converts a cursor field value for json. Timestamps are RFC 3339
+// regardless of --time-format, so cursorValues can read them back.
+func cursorValue(v interface{}) interface{} {
+	if t, ok := v.(time.Time); ok {
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+	return outputValue(v)
+}
+
+// cursor returns the value to pass to --start-after to continue a query after
+// the given document: the json array of its order-by field values, or its id
+// if unordered.
+func cursor(orders []order, doc *firestore.DocumentSnapshot) (string, error) {
+	if len(orders) == 0 {
+		return doc.Ref.ID, nil
+	}
+	values := make([]interface{}, len(orders))
+	for i, o := range orders {
+		v, err := orderValue(o, doc)
+		if err != nil {
+			return "", errors.Wrapf(err, "unable to get cursor field %s", o.path)
+		}
+		values[i] = v
+	}
+	return encodeCursor(values)
+}
+
+// encodeCursor returns the cursor values as json array, which keeps values
+// containing commas intact when read back by cursorValues.
+func encodeCursor(values []interface{}) (string, error) {
+	encoded := make([]interface{}, len(values))
+	for i, v := range values {
+		encoded[i] = cursorValue(v)
+	}
+	jsonData, err := json.Marshal(encoded)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to marshal cursor to json")
+	}
+	return string(jsonData), nil
+}
+
+func applyClauses(q firestore.Query, clauses []clause) firestore.Query {
+	for _, c := range clauses {
+		if c.op == "or" {
+			q = q.WhereEntity(c.filter())
+		} else if c.fieldPath != nil {
+			q = q.WherePath(c.fieldPath, c.op, c.value)
+		} else {
+			q = q.Where(c.path, c.op, c.value)
+		}
+	}
+	return q
+}
+
+// filter returns the clause as a firestore filter, or-clauses as a
+// disjunction of the conjunctions of their groups.
+func (c clause) filter() firestore.EntityFilter {
+	if groups, ok := c.value.([][]clause); ok {
+		or := firestore.OrFilter{}
+		for _, group := range groups {
+			if len(group) == 1 {
+				or.Filters = append(or.Filters, group[0].filter())
+				continue
+			}
+			and := firestore.AndFilter{}
+			for _, gc := range group {
+				and.Filters = append(and.Filters, gc.filter())
+			}
+			or.Filters = append(or.Filters, and)
+		}
+		return or
+	}
+	if c.fieldPath != nil {
+		return firestore.PropertyPathFilter{Path: c.fieldPath, Operator: c.op, Value: c.value}
+	}
+	return firestore.PropertyFilter{Path: c.path, Operator: c.op, Value: c.value}
+}
+
+// setFieldPaths splits the paths of the clauses, including the ones of
+// or-clauses, into field names, see parseFieldPath.
+func setFieldPaths(clauses []clause, literals []string) error {
+	for i, c := range clauses {
+		if groups, ok := c.value.([][]clause); ok {
+			for _, group := range groups {
+				if err := setFieldPaths(group, literals); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if c.path == firestore.DocumentID {
+			continue
+		}
+		fieldPath, err := parseFieldPath(c.path, literals)
+		if err != nil {
+			return err
+		}
+		clauses[i].fieldPath = fieldPath
+	}
+	return nil
+}
+
+// parseFieldPath splits a dotted field path like address.city into its field
+// names. Field names containing dots or other special characters can be
+// quoted with backticks, as in `a.b`.c, or given literally with --field-path.
+func parseFieldPath(path string, literals []string) (firestore.FieldPath, error) {
+	for _, literal := range literals {
+		if path == literal {
+			return firestore.FieldPath{path}, nil
+		}
+	}
+	var fieldPath firestore.FieldPath
+	var name strings.Builder
+	quoted := false
+	for _, r := range path {
+		switch {
+		case r == '`':
+			quoted = !quoted
+		case r == '.' && !quoted:
+			fieldPath = append(fieldPath, name.String())
+			name.Reset()
+		default:
+			name.WriteRune(r)
+		}
+	}
+	fieldPath = append(fieldPath, name.String())
+	if quoted {
+		return nil, fmt.Errorf("invalid field path %q, unterminated backtick", path)
+	}
+	for _, name := range fieldPath {
+		if name == "" {
+			return nil, fmt.Errorf("invalid field path %q, empty field name", path)
+		}
+	}
+	return fieldPath, nil
+}
+
+func clausesString(clauses []clause) string {
+	s := make([]string, len(clauses))
+	for i, c := range clauses {
+		s[i] = c.String()
+	}
+	return strings.Join(s, " && ")
+}
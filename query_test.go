@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"google.golang.org/api/option"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	createdAt := time.Date(2024, 3, 1, 12, 30, 15, 123456789, time.UTC)
+	tests := []struct {
+		name   string
+		orders []order
+		values []interface{}
+	}{
+		{"timestamp", []order{{path: "createdAt"}}, []interface{}{createdAt}},
+		{"comma in string", []order{{path: "name"}}, []interface{}{"Doe, Jane"}},
+		{"numeric string", []order{{path: "zip"}}, []interface{}{"01234"}},
+		{"numbers", []order{{path: "age"}, {path: "score"}}, []interface{}{int64(42), 2.5}},
+		{"bool and null", []order{{path: "active"}, {path: "deletedAt"}}, []interface{}{true, nil}},
+		{"large int", []order{{path: "n"}}, []interface{}{int64(9007199254740993)}},
+		{"document id", []order{{path: "createdAt"}, {path: firestore.DocumentID}}, []interface{}{createdAt, "123"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := encodeCursor(tt.values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := cursorValues(s, tt.orders)
+			if len(got) != len(tt.values) {
+				t.Fatalf("cursorValues(%s) = %v, want %v", s, got, tt.values)
+			}
+			for i, want := range tt.values {
+				if wantTime, ok := want.(time.Time); ok {
+					if gotTime, ok := got[i].(time.Time); !ok || !gotTime.Equal(wantTime) {
+						t.Errorf("cursorValues(%s)[%d] = %#v, want %v", s, i, got[i], want)
+					}
+					continue
+				}
+				if !reflect.DeepEqual(got[i], want) {
+					t.Errorf("cursorValues(%s)[%d] = %#v, want %#v", s, i, got[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestCursorValuesCommaSeparated(t *testing.T) {
+	got := cursorValues("18,Berlin,2023-01-01T00:00:00Z", nil)
+	want := []interface{}{int64(18), "Berlin", time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("cursorValues = %#v, want %#v", got, want)
+	}
+}
+
+func TestListOperatorLimits(t *testing.T) {
+	ids := func(n int) string {
+		s := make([]string, n)
+		for i := range s {
+			s[i] = fmt.Sprintf("id%d", i)
+		}
+		return strings.Join(s, ",")
+	}
+	tests := []struct {
+		path, op string
+		n        int
+	}{
+		{"status", "in", 31},
+		{"status", "not-in", 11},
+		{"tags", "array-contains-any", 31},
+		{firestore.DocumentID, "in", 31},
+		{firestore.DocumentID, "not-in", 11},
+	}
+	for _, tt := range tests {
+		if _, err := newClause(tt.path, tt.op, ids(tt.n), ""); err == nil {
+			t.Errorf("%s %s with %d values succeeded, want error", tt.path, tt.op, tt.n)
+		}
+	}
+}
+
+func TestValidateInequalities(t *testing.T) {
+	or := func(groups ...[]clause) clause {
+		return clause{op: "or", value: groups}
+	}
+	tests := []struct {
+		name    string
+		clauses []clause
+		orders  []order
+		wantErr bool
+	}{
+		{"range on one field", []clause{{path: "age", op: ">", value: int64(18)}, {path: "age", op: "<", value: int64(65)}}, nil, false},
+		{"different fields", []clause{{path: "age", op: ">", value: int64(18)}, {path: "score", op: "!=", value: int64(0)}}, nil, true},
+		{"equality and inequality", []clause{{path: "status", op: "==", value: "active"}, {path: "age", op: ">=", value: int64(18)}}, nil, false},
+		{"or groups on one field", []clause{or([]clause{{path: "age", op: "<", value: int64(18)}}, []clause{{path: "age", op: ">", value: int64(65)}})}, nil, false},
+		{"or groups on different fields", []clause{or([]clause{{path: "age", op: "<", value: int64(18)}}, []clause{{path: "score", op: ">", value: int64(5)}})}, nil, true},
+		{"or group and where on different fields", []clause{{path: "age", op: ">", value: int64(18)}, or([]clause{{path: "status", op: "==", value: "a"}, {path: "score", op: "<", value: int64(1)}}, []clause{{path: "status", op: "==", value: "b"}})}, nil, true},
+		{"order by inequality field", []clause{{path: "age", op: ">", value: int64(18)}}, []order{{path: "age"}, {path: "name"}}, false},
+		{"order by other field", []clause{{path: "age", op: ">", value: int64(18)}}, []order{{path: "name"}}, true},
+		{"order by other field in or group", []clause{or([]clause{{path: "age", op: "<", value: int64(18)}}, []clause{{path: "status", op: "==", value: "a"}})}, []order{{path: "name"}}, true},
+		{"order without inequality", []clause{{path: "status", op: "==", value: "a"}}, []order{{path: "name"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateInequalities(tt.clauses)
+			if err == nil {
+				err = validateOrders(tt.clauses, tt.orders)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateNegations(t *testing.T) {
+	notIn := func(path string) clause {
+		return clause{path: path, op: "not-in", value: []interface{}{"a", "b"}}
+	}
+	notEqual := func(path string) clause {
+		return clause{path: path, op: "!=", value: "a"}
+	}
+	or := func(groups ...[]clause) clause {
+		return clause{op: "or", value: groups}
+	}
+	tests := []struct {
+		name    string
+		clauses []clause
+		wantErr bool
+	}{
+		{"single not-in", []clause{notIn("status")}, false},
+		{"single !=", []clause{notEqual("status")}, false},
+		{"not-in and equality", []clause{notIn("status"), {path: "type", op: "==", value: "x"}}, false},
+		{"two not-in", []clause{notIn("status"), notIn("type")}, true},
+		{"not-in and !=", []clause{notIn("status"), notEqual("status")}, true},
+		{"not-in and != on different fields", []clause{notIn("status"), notEqual("type")}, true},
+		{"not-in in or group and !=", []clause{notEqual("status"), or([]clause{notIn("status")}, []clause{{path: "type", op: "==", value: "x"}})}, true},
+		{"two not-in in or groups", []clause{or([]clause{notIn("status")}, []clause{notIn("type")})}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateNegations(tt.clauses); (err != nil) != tt.wantErr {
+				t.Errorf("validateNegations = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewClauseNotIn(t *testing.T) {
+	c, err := newClause("status", "not-in", "closed,archived", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{"closed", "archived"}; !reflect.DeepEqual(c.value, want) {
+		t.Errorf("not-in value = %#v, want %#v", c.value, want)
+	}
+}
+
+func TestMissingFieldNotes(t *testing.T) {
+	tests := []struct {
+		name    string
+		clauses []clause
+		want    []string
+	}{
+		{"equality", []clause{{path: "status", op: "==", value: "a"}}, nil},
+		{"range", []clause{{path: "age", op: ">", value: int64(18)}}, nil},
+		{"!=", []clause{{path: "status", op: "!=", value: "closed"}}, []string{
+			`note: "status != closed" only matches documents that have the field status, documents without it are excluded`,
+		}},
+		{"not-in in or group", []clause{{op: "or", value: [][]clause{
+			{{path: "type", op: "not-in", value: []interface{}{"a", "b"}}},
+			{{path: "status", op: "==", value: "a"}},
+		}}}, []string{
+			`note: "type not-in [a b]" only matches documents that have the field type, documents without it are excluded`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := missingFieldNotes(tt.clauses); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("missingFieldNotes = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFieldPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		literals []string
+		want     firestore.FieldPath
+		wantErr  bool
+	}{
+		{"single field", "name", nil, firestore.FieldPath{"name"}, false},
+		{"dotted", "address.city", nil, firestore.FieldPath{"address", "city"}, false},
+		{"deeply dotted", "a.b.c", nil, firestore.FieldPath{"a", "b", "c"}, false},
+		{"quoted segment with dot", "`a.b`.c", nil, firestore.FieldPath{"a.b", "c"}, false},
+		{"quoted last segment", "meta.`x.y`", nil, firestore.FieldPath{"meta", "x.y"}, false},
+		{"quoted special characters", "`first name`.`$ref`", nil, firestore.FieldPath{"first name", "$ref"}, false},
+		{"literal", "a.b", []string{"a.b"}, firestore.FieldPath{"a.b"}, false},
+		{"literal of other path", "a.b", []string{"c.d"}, firestore.FieldPath{"a", "b"}, false},
+		{"unterminated backtick", "`a.b", nil, nil, true},
+		{"unterminated backtick after dot", "a.`b", nil, nil, true},
+		{"empty segment", "a..b", nil, nil, true},
+		{"leading dot", ".a", nil, nil, true},
+		{"trailing dot", "a.", nil, nil, true},
+		{"empty quoted segment", "``.a", nil, nil, true},
+		{"empty path", "", nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseFieldPath(tt.path, tt.literals)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFieldPath(%q) error = %v, want error %t", tt.path, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseFieldPath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWhereCollectionArg(t *testing.T) {
+	tests := []struct {
+		args []string
+		ref  string
+		want bool
+	}{
+		{[]string{"users"}, "", true},
+		{[]string{"age", ">", "18"}, "", false},
+		{[]string{"users", "age", ">", "18"}, "", true},
+		{[]string{"owner", "=="}, "users/abc", false},
+		{[]string{"orders", "owner", "=="}, "users/abc", true},
+	}
+	for _, tt := range tests {
+		cmd := &cobra.Command{}
+		for _, flag := range typedValueFlags {
+			cmd.Flags().String(flag, "", "")
+		}
+		if err := cmd.Flags().Set("ref", tt.ref); err != nil {
+			t.Fatal(err)
+		}
+		if got := whereCollectionArg(cmd)(tt.args); got != tt.want {
+			t.Errorf("whereCollectionArg(%q) with --ref %q = %t, want %t", tt.args, tt.ref, got, tt.want)
+		}
+	}
+}
+
+func TestWhereClausesNestedFields(t *testing.T) {
+	t.Setenv("FIRESTORE_EMULATOR_HOST", "localhost:1")
+	c, err := firestore.NewClient(context.Background(), "p", option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	doc := map[string]interface{}{
+		"address":      map[string]interface{}{"city": "Berlin"},
+		"address.city": "Hamburg",
+	}
+	tests := []struct {
+		name      string
+		args      []string
+		literals  []string
+		wantPath  firestore.FieldPath
+		wantField string
+		wantValue interface{}
+	}{
+		{"nested map", []string{"address.city", "==", "Berlin"}, nil, firestore.FieldPath{"address", "city"}, "address.city", "Berlin"},
+		{"quoted dotted key", []string{"`address.city`", "==", "Hamburg"}, nil, firestore.FieldPath{"address.city"}, "`address.city`", "Hamburg"},
+		{"literal dotted key", []string{"address.city", "==", "Hamburg"}, []string{"address.city"}, firestore.FieldPath{"address.city"}, "`address.city`", "Hamburg"},
+	}
+	fieldPathFlag := whereCmd.Flags().Lookup("field-path").Value.(pflag.SliceValue)
+	defer fieldPathFlag.Replace(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := fieldPathFlag.Replace(tt.literals); err != nil {
+				t.Fatal(err)
+			}
+			clauses, err := whereClauses(whereCmd, tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(clauses[0].fieldPath, tt.wantPath) {
+				t.Errorf("field path = %q, want %q", clauses[0].fieldPath, tt.wantPath)
+			}
+
+			wire, err := applyClauses(c.Collection("users").Query, clauses).Serialize()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var req firestorepb.RunQueryRequest
+			if err := proto.Unmarshal(wire, &req); err != nil {
+				t.Fatal(err)
+			}
+			filter := req.GetStructuredQuery().GetWhere().GetFieldFilter()
+			if got := filter.GetField().GetFieldPath(); got != tt.wantField {
+				t.Errorf("filter field = %q, want %q", got, tt.wantField)
+			}
+
+			// firestore resolves the path segment by segment, the nested map
+			// and the top-level key with a dot are different fields
+			value, ok := valueAtPath(doc, clauses[0].fieldPath)
+			if !ok || value != tt.wantValue {
+				t.Errorf("value at %q = %v, want %v", clauses[0].fieldPath, value, tt.wantValue)
+			}
+			if value != clauses[0].value {
+				t.Errorf("document does not match %v", clauses[0])
+			}
+		})
+	}
+}
+
+// valueAtPath returns the value of the document data at the field path.
+func valueAtPath(data map[string]interface{}, path firestore.FieldPath) (interface{}, bool) {
+	var value interface{} = data
+	for _, name := range path {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[name]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
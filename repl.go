@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/chzyer/readline"
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// replCommands are the commands that can be run in a repl session. Commands
+// reading documents from stdin are left out, stdin belongs to the prompt.
+var replCommands = map[string]bool{
+	"get":         true,
+	"where":       true,
+	"documents":   true,
+	"count":       true,
+	"aggregate":   true,
+	"describe":    true,
+	"collections": true,
+	"batch-get":   true,
+	"update":      true,
+	"delete":      true,
+}
+
+const replHelp = `commands:
+use <collection>     switch to another collection
+project <id>         switch to another project, reconnecting the client
+get, where, documents, count, aggregate, describe, collections, batch-get,
+update, delete       same as the cli commands, including their flags
+help                 show this help
+exit, quit           end the session
+`
+
+var replCmd = &cobra.Command{
+	Use:   "repl",
+	Short: "run commands interactively in a single session",
+	Long: `starts an interactive session that keeps the firestore client connected.
+the commands take the same arguments and flags as on the command line, the
+current collection is changed with "use" and the project with "project".
+the history is kept in ~/.firestore-cli_history.
+
+examples:
+firestore-cli repl
+firestore-cli repl -c users`,
+	Args:    cobra.NoArgs,
+	PreRunE: projectPreRunE,
+	RunE:    repl,
+}
+
+func repl(_ *cobra.Command, _ []string) error {
+	home, err := homedir.Dir()
+	if err != nil {
+		return errors.Wrap(err, "unable to find home directory")
+	}
+	collectionPath := viper.GetString("collection")
+	// flags given when starting the session apply to every line
+	sessionFlags := flagValues(rootCmd.PersistentFlags())
+	// the collection is switched with use instead
+	delete(sessionFlags, "collection")
+	delete(sessionFlags, "collection-group")
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:      replPrompt(collectionPath),
+		HistoryFile: filepath.Join(home, ".firestore-cli_history"),
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to start repl")
+	}
+	defer rl.Close()
+
+	for {
+		line, err := rl.Readline()
+		if err == readline.ErrInterrupt {
+			if line == "" {
+				return nil
+			}
+			continue
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "unable to read line")
+		}
+		args, err := splitLine(line)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		switch args[0] {
+		case "exit", "quit":
+			return nil
+		case "help":
+			fmt.Fprint(os.Stderr, replHelp)
+		case "use":
+			if len(args) != 2 {
+				fmt.Fprintln(os.Stderr, "usage: use <collection>")
+				continue
+			}
+			if err := validatePath(args[1], true); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				continue
+			}
+			collectionPath = args[1]
+		case "project":
+			if len(args) != 2 {
+				fmt.Fprintln(os.Stderr, "usage: project <id>")
+				continue
+			}
+			// the client is bound to a project, the next command reconnects
+			if client != nil {
+				_ = client.Close()
+				client = nil
+			}
+			viper.Set("project", args[1])
+		default:
+			if err := replExecute(args, collectionPath, sessionFlags); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+		rl.SetPrompt(replPrompt(collectionPath))
+	}
+}
+
+// replPrompt shows the current project and collection.
+func replPrompt(collectionPath string) string {
+	if collectionPath == "" {
+		return viper.GetString("project") + "> "
+	}
+	return viper.GetString("project") + ":" + collectionPath + "> "
+}
+
+// replExecute runs a command of a repl session with the handlers of the cli
+// command. The flags are reset first, so they only apply to the line they are
+// given on. The client stays connected between lines.
+func replExecute(args []string, collectionPath string, sessionFlags map[string][]string) error {
+	if !replCommands[args[0]] {
+		return fmt.Errorf("unknown command %q, try help", args[0])
+	}
+	cmd, _, err := rootCmd.Find(args[:1])
+	if err != nil {
+		return err
+	}
+	// ctrl-c only interrupts the command, not the session
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	rootCtx = ctx
+	resetFlags(cmd.Flags(), sessionFlags)
+	if err := cmd.ParseFlags(args[1:]); err != nil {
+		return err
+	}
+	if cmd.Flags().Changed("collection") {
+		collectionPath, _ = cmd.Flags().GetString("collection")
+	}
+	viper.Set("collection", collectionPath)
+	collectionGroup, _ := cmd.Flags().GetString("collection-group")
+	viper.Set("collection-group", collectionGroup)
+
+	positional := cmd.Flags().Args()
+	if err := cmd.ValidateArgs(positional); err != nil {
+		return err
+	}
+	if err := cmd.PreRunE(cmd, positional); err != nil {
+		return err
+	}
+	return cmd.RunE(cmd, positional)
+}
+
+// flagValues returns the values of the flags that were set.
+func flagValues(flags *pflag.FlagSet) map[string][]string {
+	values := make(map[string][]string)
+	flags.Visit(func(f *pflag.Flag) {
+		if s, ok := f.Value.(pflag.SliceValue); ok {
+			values[f.Name] = s.GetSlice()
+		} else {
+			values[f.Name] = []string{f.Value.String()}
+		}
+	})
+	return values
+}
+
+// resetFlags sets all flags back to the given values, or to their defaults if
+// not given.
+func resetFlags(flags *pflag.FlagSet, values map[string][]string) {
+	flags.VisitAll(func(f *pflag.Flag) {
+		value, ok := values[f.Name]
+		if s, isSlice := f.Value.(pflag.SliceValue); isSlice {
+			_ = s.Replace(value)
+		} else if ok {
+			_ = f.Value.Set(value[0])
+		} else {
+			_ = f.Value.Set(f.DefValue)
+		}
+		f.Changed = ok
+	})
+}
+
+// splitLine splits a repl line into arguments like a shell, honoring single
+// and double quotes and backslash escapes.
+func splitLine(line string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			arg.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote %c", quote)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	initialBackoff = 200 * time.Millisecond
+	maxBackoff     = 5 * time.Second
+)
+
+// noRetry marks an error as final, e.g. because documents were already
+// written to the output when it occurred.
+type noRetry struct {
+	error
+}
+
+func (e noRetry) Unwrap() error {
+	return e.error
+}
+
+// retryable reports whether err is a transient firestore error worth
+// retrying.
+func retryable(err error) bool {
+	if errors.As(err, &noRetry{}) {
+		return false
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+// retry calls fn until it succeeds or fails with an error that is not
+// retryable, for at most the configured number of retries. The backoff
+// between attempts doubles each time and is bounded by the deadline of ctx.
+func retry(ctx context.Context, fn func() error) error {
+	retries := viper.GetInt("retries")
+	backoff := initialBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt > retries || !retryable(err) || ctx.Err() != nil {
+			return err
+		}
+		if verbose {
+			fmt.Fprintf(os.Stderr, "retry %d of %d in %s: %v\n", attempt, retries, backoff, err)
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"github.com/spf13/cobra"
+)
+
+// documentSchema compiles the json schema file given with the "schema" flag.
+// It returns nil if no schema is given.
+func documentSchema(cmd *cobra.Command) (*jsonschema.Schema, error) {
+	file, err := cmd.Flags().GetString("schema")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get flag \"schema\"")
+	}
+	if file == "" {
+		return nil, nil
+	}
+	schema, err := jsonschema.Compile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to compile schema")
+	}
+	return schema, nil
+}
+
+// validateDocument checks the document data against the schema, reporting
+// every failing field. A nil schema accepts all documents.
+func validateDocument(schema *jsonschema.Schema, data map[string]interface{}) error {
+	if schema == nil {
+		return nil
+	}
+	err := schema.Validate(data)
+	if err == nil {
+		return nil
+	}
+	ve, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return errors.Wrap(err, "unable to validate document")
+	}
+	var msgs []string
+	for _, leaf := range schemaViolations(ve) {
+		location := leaf.InstanceLocation
+		if location == "" {
+			location = "/"
+		}
+		msgs = append(msgs, fmt.Sprintf("%s: %s", location, leaf.Message))
+	}
+	return fmt.Errorf("document does not match schema: %s", strings.Join(msgs, "; "))
+}
+
+// schemaViolations returns the innermost errors of a validation error, which
+// name the offending fields.
+func schemaViolations(ve *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	if len(ve.Causes) == 0 {
+		return []*jsonschema.ValidationError{ve}
+	}
+	var leaves []*jsonschema.ValidationError
+	for _, cause := range ve.Causes {
+		leaves = append(leaves, schemaViolations(cause)...)
+	}
+	return leaves
+}
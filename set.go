@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var setCmd = &cobra.Command{
+	Use:   "set [collection] [document id]",
+	Short: "create or overwrite a document",
+	Long: `reads a json object from --data or stdin and writes it to the collection.
+if the document id is omitted, an id is generated and printed. the document
+can also be given as a full document path, in which case the collection is not
+needed.
+
+string values can be write sentinels: "@serverTimestamp" is replaced by the
+server time, "@increment:<number>" adds to a numeric field and "@delete"
+removes a field, the latter only with --merge.
+
+with --merge only the given fields are written and the document is created if
+it does not exist, other fields are left untouched. --merge-field restricts
+the merge to the named fields. unlike update, set --merge does not fail on
+missing documents, and nested objects are merged instead of replaced.
+
+the data can also be read from a file with --data-file or --data @path, the
+path - reads from stdin.
+
+examples:
+firestore-cli set 22da76b6 --data '{"name":"foo"}'
+firestore-cli set 22da76b6 --data-file user.json
+firestore-cli set users/abc/orders/22da76b6 --data '{"total":3}'
+firestore-cli set 22da76b6 --data @user.json
+echo '{"name":"foo"}' | firestore-cli set
+firestore-cli set 22da76b6 --merge --data '{"address":{"city":"Berlin"}}'
+firestore-cli set 22da76b6 --merge-field name --data '{"name":"foo","age":3}'
+firestore-cli set 22da76b6 --schema user.schema.json --data '{"name":"foo"}'
+firestore-cli set 22da76b6 --data '{"name":"foo","createdAt":"@serverTimestamp"}'`,
+	Args:    cobra.MaximumNArgs(1),
+	PreRunE: documentPreRunE,
+	RunE:    set,
+}
+
+func set(cmd *cobra.Command, args []string) error {
+	var documentID string
+	if len(args) > 0 {
+		documentID = args[0]
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "{\"ProjectID\":\"%s\", \"CollectionPath\":\"%s\", \"DocumentID\":\"%s\", \"Emulator\":%t}\n",
+			viper.GetString("project"),
+			viper.GetString("collection"),
+			documentID,
+			emulator)
+	}
+	data, err := documentData(cmd)
+	if err != nil {
+		return err
+	}
+	schema, err := documentSchema(cmd)
+	if err != nil {
+		return err
+	}
+	if err := validateDocument(schema, data); err != nil {
+		return err
+	}
+	if err := resolveSentinels(data); err != nil {
+		return err
+	}
+	opts, err := setOptions(cmd)
+	if err != nil {
+		return err
+	}
+	if len(opts) > 0 && documentID == "" {
+		return errors.New("merge requires a document id")
+	}
+
+	var docRef *firestore.DocumentRef
+	if documentID != "" {
+		if docRef, err = documentRef(documentID); err != nil {
+			return err
+		}
+	}
+
+	if viper.GetBool("dry-run") {
+		if docRef == nil {
+			docRef = collection().NewDoc()
+		}
+		op := "set"
+		if len(opts) > 0 {
+			op = "merge"
+		}
+		return printDryRun(op, docRef, data)
+	}
+
+	ctx, cancelFunc := withTimeout()
+	defer cancelFunc()
+	if documentID == "" {
+		docRef, _, err := collection().Add(ctx, data)
+		if err != nil {
+			return errors.Wrap(err, "unable to add document")
+		}
+		fmt.Fprintln(out, docRef.ID)
+		return nil
+	}
+	_, err = docRef.Set(ctx, data, opts...)
+	return errors.Wrap(err, "unable to set document")
+}
+
+// setOptions returns the merge option selected by the "merge" and
+// "merge-field" flags, if any.
+func setOptions(cmd *cobra.Command) ([]firestore.SetOption, error) {
+	merge, err := cmd.Flags().GetBool("merge")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get flag \"merge\"")
+	}
+	fields, err := cmd.Flags().GetStringSlice("merge-field")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get flag \"merge-field\"")
+	}
+	if len(fields) > 0 {
+		paths := make([]firestore.FieldPath, len(fields))
+		for i, field := range fields {
+			paths[i] = strings.Split(field, ".")
+		}
+		return []firestore.SetOption{firestore.Merge(paths...)}, nil
+	}
+	if merge {
+		return []firestore.SetOption{firestore.MergeAll}, nil
+	}
+	return nil, nil
+}
+
+// dataFlag returns the json given with the "data" flag, or read from the file
+// given with the "data-file" flag or as "--data @path". The path "-" reads
+// from stdin. It returns nil if neither flag is given.
+func dataFlag(cmd *cobra.Command) ([]byte, error) {
+	raw, err := cmd.Flags().GetString("data")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get flag \"data\"")
+	}
+	file, err := cmd.Flags().GetString("data-file")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get flag \"data-file\"")
+	}
+	if raw != "" && file != "" {
+		return nil, errors.New("data can not be combined with --data-file")
+	}
+	if strings.HasPrefix(raw, "@") {
+		file = raw[1:]
+	} else if raw != "" {
+		return []byte(raw), nil
+	}
+	switch file {
+	case "":
+		return nil, nil
+	case "-":
+		jsonData, err := ioutil.ReadAll(os.Stdin)
+		return jsonData, errors.Wrap(err, "unable to read data from stdin")
+	}
+	jsonData, err := ioutil.ReadFile(file)
+	return jsonData, errors.Wrap(err, "unable to read data file")
+}
+
+// documentData reads the document json from the "data" or "data-file" flag,
+// or from stdin if neither is given, and unmarshals it into a map.
+func documentData(cmd *cobra.Command) (map[string]interface{}, error) {
+	jsonData, err := dataFlag(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if jsonData == nil {
+		jsonData, err = ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read document from stdin")
+		}
+	}
+	data, err := parseJSONObject(jsonData)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to unmarshal document json")
+	}
+	return data, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"cloud.google.com/go/firestore"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var txUpdateCmd = &cobra.Command{
+	Use:   "tx-update [collection] [document id] [field=value]...",
+	Short: "update fields of a document in a transaction",
+	Long: `reads and updates a document atomically in a transaction, which firestore
+retries if the document is modified concurrently. with --upsert a missing
+document is created from the updates.
+
+examples:
+firestore-cli tx-update 22da76b6 status=active address.city=Berlin
+firestore-cli tx-update 22da76b6 --data '{"status":"active"}' --upsert`,
+	Args:    cobra.MinimumNArgs(1),
+	PreRunE: documentPreRunE,
+	RunE:    txUpdate,
+}
+
+func txUpdate(cmd *cobra.Command, args []string) error {
+	documentID := args[0]
+	upsert, err := cmd.Flags().GetBool("upsert")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"upsert\"")
+	}
+	updates, err := parseUpdates(cmd, args[1:])
+	if err != nil {
+		return err
+	}
+	if len(updates) == 0 {
+		return errors.New("no fields to update")
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "{\"ProjectID\":\"%s\", \"CollectionPath\":\"%s\", \"DocumentID\":\"%s\", \"Emulator\":%t}\n",
+			viper.GetString("project"),
+			viper.GetString("collection"),
+			documentID,
+			emulator)
+	}
+	docRef, err := documentRef(documentID)
+	if err != nil {
+		return err
+	}
+
+	if viper.GetBool("dry-run") {
+		return printDryRun("update", docRef, updatedFields(updates))
+	}
+
+	ctx, cancelFunc := withTimeout()
+	defer cancelFunc()
+	attempts := 0
+	err = client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		attempts++
+		if verbose && attempts > 1 {
+			fmt.Fprintf(os.Stderr, "transaction aborted by concurrent modification, attempt %d\n", attempts)
+		}
+		_, err := tx.Get(docRef)
+		if status.Code(err) == codes.NotFound {
+			if !upsert {
+				return errors.Wrapf(err, "document %s not found", documentID)
+			}
+			return tx.Set(docRef, updatesData(updates))
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Update(docRef, updates)
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to update document in transaction")
+	}
+
+	if verbose {
+		docSnap, err := docRef.Get(ctx)
+		if err != nil {
+			return errors.Wrap(err, "unable to get updated document")
+		}
+		jsonString, err := jsonString(documentFields(docSnap))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, jsonString)
+	}
+	return nil
+}
+
+// updatesData builds the document data equivalent to applying the updates to
+// an empty document, nesting fields according to their paths.
+func updatesData(updates []firestore.Update) map[string]interface{} {
+	data := map[string]interface{}{}
+	for _, u := range updates {
+		path := u.FieldPath
+		if path == nil {
+			path = firestore.FieldPath{u.Path}
+		}
+		m := data
+		for _, field := range path[:len(path)-1] {
+			next, ok := m[field].(map[string]interface{})
+			if !ok {
+				next = map[string]interface{}{}
+				m[field] = next
+			}
+			m = next
+		}
+		m[path[len(path)-1]] = u.Value
+	}
+	return data
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.yaml.in/yaml/v3"
+	"google.golang.org/genproto/googleapis/type/latlng"
+)
+
+// fieldTypes are the field types of document types defined in the types
+// file, mapped to the go types firestore decodes them into.
+var fieldTypes = map[string]reflect.Type{
+	"string":    reflect.TypeOf(""),
+	"int":       reflect.TypeOf(int64(0)),
+	"float":     reflect.TypeOf(float64(0)),
+	"bool":      reflect.TypeOf(false),
+	"timestamp": reflect.TypeOf(time.Time{}),
+	"bytes":     reflect.TypeOf([]byte(nil)),
+	"ref":       reflect.TypeOf((*firestore.DocumentRef)(nil)),
+	"geo":       reflect.TypeOf((*latlng.LatLng)(nil)),
+	"map":       reflect.TypeOf(map[string]interface{}(nil)),
+	"array":     reflect.TypeOf([]interface{}(nil)),
+	"any":       reflect.TypeOf((*interface{})(nil)).Elem(),
+}
+
+// maxTypeDepth bounds the nesting of document types, which can refer to each
+// other.
+const maxTypeDepth = 16
+
+// documentTypes reads the document types from the file given with the
+// "types-file" flag, a yaml map from type name to field names and types,
+// for example
+//
+//	user:
+//	  name: string
+//	  age: int
+//	  tags: "[]string"
+//	  address: address
+//	address:
+//	  city: string
+//
+// Field types are the keys of fieldTypes, []<type> for arrays, or the name of
+// another document type for nested maps.
+func documentTypes() (map[string]map[string]string, error) {
+	file := viper.GetString("types-file")
+	if file == "" {
+		return nil, errors.New("types-file undefined, it defines the types for --as")
+	}
+	yamlData, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read types file")
+	}
+	var types map[string]map[string]string
+	if err := yaml.Unmarshal(yamlData, &types); err != nil {
+		return nil, errors.Wrap(err, "unable to unmarshal types file")
+	}
+	return types, nil
+}
+
+// documentType builds a struct type for the named document type, with a
+// field for each of its fields tagged with the field name for firestore.
+func documentType(name string) (reflect.Type, error) {
+	types, err := documentTypes()
+	if err != nil {
+		return nil, err
+	}
+	return structType(types, name, 0)
+}
+
+func structType(types map[string]map[string]string, name string, depth int) (reflect.Type, error) {
+	if depth > maxTypeDepth {
+		return nil, fmt.Errorf("type %s nested too deep", name)
+	}
+	fields, ok := types[name]
+	if !ok {
+		return nil, fmt.Errorf("type %s not found in types file", name)
+	}
+	names := make([]string, 0, len(fields))
+	for field := range fields {
+		names = append(names, field)
+	}
+	sort.Strings(names)
+	structFields := make([]reflect.StructField, len(names))
+	for i, field := range names {
+		t, err := typeOf(types, fields[field], depth)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid field %s of type %s", field, name)
+		}
+		structFields[i] = reflect.StructField{
+			// the go field names only need to be exported, the tag names
+			// the document field
+			Name: fmt.Sprintf("F%d", i),
+			Type: t,
+			Tag:  reflect.StructTag(fmt.Sprintf("firestore:%q", field)),
+		}
+	}
+	return reflect.StructOf(structFields), nil
+}
+
+func typeOf(types map[string]map[string]string, typ string, depth int) (reflect.Type, error) {
+	if strings.HasPrefix(typ, "[]") {
+		elem, err := typeOf(types, typ[2:], depth)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.SliceOf(elem), nil
+	}
+	if t, ok := fieldTypes[typ]; ok {
+		return t, nil
+	}
+	if _, ok := types[typ]; ok {
+		return structType(types, typ, depth+1)
+	}
+	return nil, fmt.Errorf("unknown type %q", typ)
+}
+
+// asType returns the struct type selected with the "as" flag, or nil if the
+// flag is not given.
+func asType(cmd *cobra.Command) (reflect.Type, error) {
+	name, err := cmd.Flags().GetString("as")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get flag \"as\"")
+	}
+	if name == "" {
+		return nil, nil
+	}
+	return documentType(name)
+}
+
+// decodeAs decodes the document into a new value of the struct type, failing
+// on fields whose values do not fit.
+func decodeAs(t reflect.Type, doc *firestore.DocumentSnapshot) error {
+	return doc.DataTo(reflect.New(t).Interface())
+}
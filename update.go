@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var updateCmd = &cobra.Command{
+	Use:   "update [collection] [document id] [field=value]...",
+	Short: "update fields of a document",
+	Long: `updates the given fields of an existing document, leaving other fields untouched.
+the document can also be given as a full document path, in which case the
+collection is not needed. nested fields can be addressed with dotted paths. the values @serverTimestamp,
+@increment:<number> and @delete set the server time, add to a numeric field
+and remove a field. @arrayUnion:a,b adds elements missing in an array field,
+@arrayRemove:a,b removes all occurrences of the elements. updating a missing document
+fails with exit code 2. with --require-exists the document is read first and
+the update fails with exit code 4 if it was deleted or modified in between.
+
+examples:
+firestore-cli update 22da76b6 status=active address.city=Berlin
+firestore-cli update 22da76b6 --data '{"status":"active"}'
+firestore-cli update users/abc/orders/22da76b6 status=shipped
+firestore-cli update 22da76b6 --data @status.json
+firestore-cli update 22da76b6 status=active --require-exists
+firestore-cli update 22da76b6 updatedAt=@serverTimestamp visits=@increment:1 legacy=@delete
+firestore-cli update 22da76b6 tags=@arrayUnion:urgent,important scores=@arrayRemove:0`,
+	Args:    cobra.MinimumNArgs(1),
+	PreRunE: documentPreRunE,
+	RunE:    update,
+}
+
+func update(cmd *cobra.Command, args []string) error {
+	documentID := args[0]
+	updates, err := parseUpdates(cmd, args[1:])
+	if err != nil {
+		return err
+	}
+	if len(updates) == 0 {
+		return errors.New("no fields to update")
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "{\"ProjectID\":\"%s\", \"CollectionPath\":\"%s\", \"DocumentID\":\"%s\", \"Emulator\":%t}\n",
+			viper.GetString("project"),
+			viper.GetString("collection"),
+			documentID,
+			emulator)
+	}
+
+	docRef, err := documentRef(documentID)
+	if err != nil {
+		return err
+	}
+	if viper.GetBool("dry-run") {
+		return printDryRun("update", docRef, updatedFields(updates))
+	}
+
+	requireExists, err := cmd.Flags().GetBool("require-exists")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"require-exists\"")
+	}
+	ctx, cancelFunc := withTimeout()
+	defer cancelFunc()
+	var preconds []firestore.Precondition
+	if requireExists {
+		// update always fails on missing documents, pinning the update time
+		// also catches documents deleted or changed since they were read
+		docSnap, err := docRef.Get(ctx)
+		if status.Code(err) == codes.NotFound {
+			return errors.Wrapf(err, "document %s does not exist", documentID)
+		}
+		if err != nil {
+			return errors.Wrap(err, "unable to get document")
+		}
+		preconds = append(preconds, firestore.LastUpdateTime(docSnap.UpdateTime))
+	}
+	_, err = docRef.Update(ctx, updates, preconds...)
+	switch status.Code(err) {
+	case codes.NotFound:
+		return errors.Wrapf(err, "document %s does not exist", documentID)
+	case codes.FailedPrecondition:
+		return errors.Wrapf(err, "document %s was deleted or modified concurrently", documentID)
+	}
+	return errors.Wrap(err, "unable to update document")
+}
+
+// updatedFields maps the dotted field paths of the updates to their values.
+func updatedFields(updates []firestore.Update) map[string]interface{} {
+	fields := make(map[string]interface{}, len(updates))
+	for _, u := range updates {
+		path := u.Path
+		if u.FieldPath != nil {
+			path = strings.Join(u.FieldPath, ".")
+		}
+		fields[path] = u.Value
+	}
+	return fields
+}
+
+// parseUpdates builds the list of field updates from field=value arguments
+// and the optional "data" or "data-file" flag.
+func parseUpdates(cmd *cobra.Command, args []string) ([]firestore.Update, error) {
+	var updates []firestore.Update
+	for _, arg := range args {
+		i := strings.Index(arg, "=")
+		if i < 1 {
+			return nil, fmt.Errorf("invalid update %q, expected field=value", arg)
+		}
+		value, ok, err := writeSentinel(arg[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			value = parseValue(arg[i+1:])
+		}
+		updates = append(updates, firestore.Update{
+			FieldPath: strings.Split(arg[:i], "."),
+			Value:     value,
+		})
+	}
+
+	raw, err := dataFlag(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if raw != nil {
+		data, err := parseJSONObject(raw)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to unmarshal update json")
+		}
+		if err := resolveSentinels(data); err != nil {
+			return nil, err
+		}
+		for field, value := range data {
+			updates = append(updates, firestore.Update{FieldPath: firestore.FieldPath{field}, Value: value})
+		}
+	}
+	return updates, nil
+}
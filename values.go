@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"google.golang.org/genproto/googleapis/type/latlng"
+)
+
+// parseValue infers the type of a command line value. Integers, floats,
+// booleans, null and timestamps are recognized, anything else is kept as
+// string.
+func parseValue(raw string) interface{} {
+	if intValue, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return intValue
+	}
+	// ParseFloat also accepts words like "inf" and "nan", keep those as strings
+	if floatValue, err := strconv.ParseFloat(raw, 64); err == nil && !math.IsInf(floatValue, 0) && !math.IsNaN(floatValue) {
+		return floatValue
+	}
+	switch raw {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+	if t, err := parseTimestamp(raw); err == nil {
+		return t
+	}
+	return raw
+}
+
+// parseTimestamp parses an RFC3339 timestamp or a bare date like 2023-01-02,
+// which is normalized to midnight UTC.
+func parseTimestamp(raw string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp value %q, expected RFC3339 or YYYY-MM-DD", raw)
+	}
+	return t, nil
+}
+
+// parseTypedValue converts a command line value to the given type, one of
+// string, int, float, bool, null, timestamp, ref, geo or json. An empty type
+// infers the type with parseValue.
+func parseTypedValue(raw, typ string) (interface{}, error) {
+	switch typ {
+	case "":
+		return parseValue(raw), nil
+	case "string":
+		return raw, nil
+	case "int":
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid int value %q", raw)
+		}
+		return v, nil
+	case "float":
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float value %q", raw)
+		}
+		return v, nil
+	case "bool":
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bool value %q", raw)
+		}
+		return v, nil
+	case "null":
+		return nil, nil
+	case "timestamp":
+		return parseTimestamp(raw)
+	case "ref":
+		return documentRef(raw)
+	case "geo":
+		return parseGeoPoint(raw)
+	case "json":
+		return parseJSON(raw)
+	}
+	return nil, fmt.Errorf("unknown value type %q", typ)
+}
+
+// parseGeoPoint parses a geo point of the form "lat,lng".
+func parseGeoPoint(raw string) (*latlng.LatLng, error) {
+	parts := strings.Split(raw, ",")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid geo value %q, expected \"lat,lng\"", raw)
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid geo value %q, expected \"lat,lng\"", raw)
+	}
+	lng, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid geo value %q, expected \"lat,lng\"", raw)
+	}
+	if lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		return nil, fmt.Errorf("invalid geo value %q, latitude or longitude out of range", raw)
+	}
+	return &latlng.LatLng{Latitude: lat, Longitude: lng}, nil
+}
+
+// isList reports whether a command line value is a json array or a comma
+// separated list.
+func isList(raw string) bool {
+	return strings.HasPrefix(strings.TrimSpace(raw), "[") || strings.Contains(raw, ",")
+}
+
+// parseList parses a json array, or a comma separated list whose elements are
+// converted to the given type (see parseTypedValue).
+func parseList(raw, typ string) ([]interface{}, error) {
+	if typ == "json" || strings.HasPrefix(strings.TrimSpace(raw), "[") {
+		v, err := parseJSON(raw)
+		if err != nil {
+			return nil, err
+		}
+		values, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid list value %s, expected a json array", raw)
+		}
+		return values, nil
+	}
+	parts := strings.Split(raw, ",")
+	values := make([]interface{}, len(parts))
+	for i, part := range parts {
+		v, err := parseTypedValue(part, typ)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// parseJSON decodes an arbitrary json value. Integral numbers are decoded as
+// int64, other numbers as float64.
+func parseJSON(raw string) (interface{}, error) {
+	dec := json.NewDecoder(strings.NewReader(raw))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, errors.Wrapf(err, "unable to unmarshal json value %s", raw)
+	}
+	return jsonNumbers(v), nil
+}
+
+// parseJSONObject decodes a json document like parseJSON, so integral
+// numbers are written to firestore as integers and not as doubles.
+func parseJSONObject(jsonData []byte) (map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(jsonData))
+	dec.UseNumber()
+	var data map[string]interface{}
+	if err := dec.Decode(&data); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("invalid data after the json document")
+	}
+	jsonNumbers(data)
+	return data, nil
+}
+
+func jsonNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = jsonNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = jsonNumbers(e)
+		}
+	}
+	return value
+}
+
+// sentinel is a parsed write sentinel. Firestore's sentinel values are
+// opaque, so dry runs keep the parsed sentinel to show what would be written.
+type sentinel struct {
+	name string
+	arg  interface{}
+}
+
+// value returns the firestore sentinel.
+func (s sentinel) value() interface{} {
+	switch s.name {
+	case "@serverTimestamp":
+		return firestore.ServerTimestamp
+	case "@delete":
+		return firestore.Delete
+	case "@increment":
+		return firestore.Increment(s.arg)
+	case "@arrayUnion":
+		return firestore.ArrayUnion(s.arg.([]interface{})...)
+	default:
+		return firestore.ArrayRemove(s.arg.([]interface{})...)
+	}
+}
+
+// output renders the sentinel for dry runs, e.g. {"@increment": 5}.
+func (s sentinel) output() interface{} {
+	if s.arg == nil {
+		return s.name
+	}
+	return map[string]interface{}{s.name: outputValue(s.arg)}
+}
+
+// writeSentinel converts the special write values @serverTimestamp, @delete,
+// @increment:<number>, @arrayUnion:<list> and @arrayRemove:<list> to the
+// corresponding firestore sentinels, or in dry runs to a sentinel for
+// printing. List elements are parsed like other values. ok reports whether
+// raw is a sentinel.
+func writeSentinel(raw string) (value interface{}, ok bool, err error) {
+	s, ok, err := parseSentinel(raw)
+	if !ok || err != nil {
+		return nil, ok, err
+	}
+	if viper.GetBool("dry-run") {
+		return s, true, nil
+	}
+	return s.value(), true, nil
+}
+
+func parseSentinel(raw string) (sentinel, bool, error) {
+	switch {
+	case raw == "@serverTimestamp", raw == "@delete":
+		return sentinel{name: raw}, true, nil
+	case strings.HasPrefix(raw, "@increment:"):
+		n := strings.TrimPrefix(raw, "@increment:")
+		if intValue, err := strconv.ParseInt(n, 10, 64); err == nil {
+			return sentinel{name: "@increment", arg: intValue}, true, nil
+		}
+		if floatValue, err := strconv.ParseFloat(n, 64); err == nil && !math.IsInf(floatValue, 0) && !math.IsNaN(floatValue) {
+			return sentinel{name: "@increment", arg: floatValue}, true, nil
+		}
+		return sentinel{}, true, fmt.Errorf("invalid increment %q, expected @increment:<number>", raw)
+	case strings.HasPrefix(raw, "@arrayUnion:"), strings.HasPrefix(raw, "@arrayRemove:"):
+		i := strings.Index(raw, ":")
+		elems, err := parseList(raw[i+1:], "")
+		if err != nil {
+			return sentinel{}, true, err
+		}
+		return sentinel{name: raw[:i], arg: elems}, true, nil
+	}
+	return sentinel{}, false, nil
+}
+
+// resolveSentinels replaces sentinel strings in document data, including
+// nested maps, by the firestore sentinels.
+func resolveSentinels(data map[string]interface{}) error {
+	for k, v := range data {
+		switch v := v.(type) {
+		case string:
+			value, ok, err := writeSentinel(v)
+			if err != nil {
+				return err
+			}
+			if ok {
+				data[k] = value
+			}
+		case map[string]interface{}:
+			if err := resolveSentinels(v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
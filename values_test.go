@@ -0,0 +1,56 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestParseJSONObject(t *testing.T) {
+	got, err := parseJSONObject([]byte(`{"n": 1, "f": 1.5, "g": 3.0, "m": {"k": [2, "x"]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"n": int64(1),
+		"f": 1.5,
+		"g": 3.0,
+		"m": map[string]interface{}{"k": []interface{}{int64(2), "x"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseJSONObject = %#v, want %#v", got, want)
+	}
+
+	for _, invalid := range []string{`[1]`, `{"a": 1} {"b": 2}`, `{"a":`} {
+		if _, err := parseJSONObject([]byte(invalid)); err == nil {
+			t.Errorf("parseJSONObject(%s) succeeded, want error", invalid)
+		}
+	}
+}
+
+func TestWriteSentinelDryRun(t *testing.T) {
+	viper.Set("dry-run", true)
+	defer viper.Set("dry-run", false)
+	tests := []struct {
+		raw  string
+		want interface{}
+	}{
+		{"@serverTimestamp", "@serverTimestamp"},
+		{"@delete", "@delete"},
+		{"@increment:5", map[string]interface{}{"@increment": int64(5)}},
+		{"@increment:0.5", map[string]interface{}{"@increment": 0.5}},
+		{"@arrayUnion:a,2", map[string]interface{}{"@arrayUnion": []interface{}{"a", int64(2)}}},
+		{"@arrayRemove:x", map[string]interface{}{"@arrayRemove": []interface{}{"x"}}},
+	}
+	for _, tt := range tests {
+		value, ok, err := writeSentinel(tt.raw)
+		if !ok || err != nil {
+			t.Errorf("writeSentinel(%q) = %v, %v", tt.raw, ok, err)
+			continue
+		}
+		if got := outputValue(value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("outputValue(writeSentinel(%q)) = %#v, want %#v", tt.raw, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"cloud.google.com/go/firestore"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch [collection] [name] [operator] [value]",
+	Short: "stream real-time document changes",
+	Long: `prints every document change of the collection, or of the documents matching
+the optional where clauses, until interrupted with ctrl-c. each change is
+printed as {"change": "added|modified|removed", "id": ..., "data": {...}}.
+
+--for stops listening after the given duration and exits successfully.
+--until-match exits as soon as a matching document exists, combined with
+--for it fails with exit code 2 if none appeared in time.
+
+examples:
+firestore-cli watch
+firestore-cli watch status == active --order-by createdAt
+firestore-cli watch --for 30s
+firestore-cli watch correlationId == 22da76b6 --until-match --for 1m`,
+	Args:    whereArgs,
+	PreRunE: queryPreRunE,
+	RunE:    watch,
+}
+
+var changeKinds = map[firestore.DocumentChangeKind]string{
+	firestore.DocumentAdded:    "added",
+	firestore.DocumentModified: "modified",
+	firestore.DocumentRemoved:  "removed",
+}
+
+func watch(cmd *cobra.Command, args []string) error {
+	clauses, err := whereClauses(cmd, args)
+	if err != nil {
+		return err
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "{\"ProjectID\":\"%s\", \"CollectionPath\":\"%s\", \"Emulator\":%t, \"Query\":\"%v\"}\n",
+			viper.GetString("project"),
+			viper.GetString("collection"),
+			emulator,
+			clausesString(clauses))
+	}
+	listenFor, err := cmd.Flags().GetDuration("for")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"for\"")
+	}
+	untilMatch, err := cmd.Flags().GetBool("until-match")
+	if err != nil {
+		return errors.Wrap(err, "unable to get flag \"until-match\"")
+	}
+	q, err := buildQuery(cmd, clauses)
+	if err != nil {
+		return err
+	}
+	f, err := newFormatter(out)
+	if err != nil {
+		return err
+	}
+
+	ctx := rootCtx
+	if listenFor > 0 {
+		var cancelFunc context.CancelFunc
+		ctx, cancelFunc = context.WithTimeout(ctx, listenFor)
+		defer cancelFunc()
+	}
+	iter := q.Snapshots(ctx)
+	defer iter.Stop()
+	for {
+		snap, err := iter.Next()
+		if ctx.Err() == context.DeadlineExceeded {
+			// listened long enough
+			if untilMatch {
+				return status.Errorf(codes.NotFound, "no matching document within %s", listenFor)
+			}
+			return nil
+		}
+		if ctx.Err() == context.Canceled || err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return iterateError(err)
+		}
+		for _, change := range snap.Changes {
+			err := f.Write(map[string]interface{}{
+				"change": changeKinds[change.Kind],
+				"id":     change.Doc.Ref.ID,
+				"data":   documentFields(change.Doc),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if err := f.Flush(); err != nil {
+			return errors.Wrap(err, "unable to write changes")
+		}
+		if untilMatch && snap.Size > 0 {
+			return nil
+		}
+	}
+}